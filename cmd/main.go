@@ -3,25 +3,33 @@ package main
 import (
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/free5gc/nfpcf/internal/logger"
 	"github.com/free5gc/nfpcf/pkg/app"
 	"github.com/free5gc/nfpcf/pkg/factory"
 	"github.com/urfave/cli/v2"
 )
 
+const configEnv = factory.EnvPrefix + "CONFIG"
+
 func main() {
 	cliApp := &cli.App{
-		Name:  "nfpcf",
-		Usage: "NF Profile Cache Function",
-		Flags: []cli.Flag{
-			&cli.StringFlag{
-				Name:    "config",
-				Aliases: []string{"c"},
-				Usage:   "Load configuration from `FILE`",
-				Value:   "./config/nfpcfcfg.yaml",
+		Name:   "nfpcf",
+		Usage:  "NF Profile Cache Function",
+		Flags:  configFlags(),
+		Action: action,
+		Commands: []*cli.Command{
+			{
+				Name:  "validate-config",
+				Usage: "Check the configuration, with overrides, and exit",
+				Flags: append(configFlags(), &cli.BoolFlag{
+					Name:  "print",
+					Usage: "print the effective configuration, secrets redacted",
+				}),
+				Action: validateConfig,
 			},
 		},
-		Action: action,
 	}
 
 	if err := cliApp.Run(os.Args); err != nil {
@@ -30,15 +38,91 @@ func main() {
 	}
 }
 
+// configFlags selects the config file and overrides its settings.
+func configFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Aliases: []string{"c"},
+			Usage:   "Load configuration from `FILE`",
+			Value:   "./config/nfpcfcfg.yaml",
+			EnvVars: []string{configEnv},
+		},
+	}, overrideFlags()...)
+}
+
+// lookup returns a flag set on the command or, for flags given before a
+// subcommand, on one of its parents.
+func lookup(cliCtx *cli.Context, name string) (string, bool) {
+	for _, ctx := range cliCtx.Lineage() {
+		if ctx.Command != nil && ctx.IsSet(name) {
+			return ctx.String(name), true
+		}
+	}
+	return cliCtx.String(name), false
+}
+
+// overrideFlags declares one flag per config setting, named after its YAML
+// path, e.g. --cache.ttl.
+func overrideFlags() []cli.Flag {
+	fields := factory.Fields()
+	flags := make([]cli.Flag, 0, len(fields))
+	for _, field := range fields {
+		flags = append(flags, &cli.StringFlag{
+			Name:     field.Path,
+			Usage:    fmt.Sprintf("override %s (env %s)", field.Path, field.Env),
+			Category: "Config overrides",
+		})
+	}
+	return flags
+}
+
+// overrides returns the environment variable overrides followed by the flag
+// overrides, so that flags take precedence.
+func overrides(cliCtx *cli.Context) []factory.Override {
+	envOverrides, unknown := factory.EnvOverrides(os.Environ(), configEnv)
+	for _, name := range unknown {
+		logger.MainLog.Warnf("Ignoring %s: no such setting", name)
+	}
+
+	result := envOverrides
+	for _, field := range factory.Fields() {
+		if value, set := lookup(cliCtx, field.Path); set {
+			result = append(result, factory.Override{
+				Path:   field.Path,
+				Value:  value,
+				Source: "--" + field.Path,
+			})
+		}
+	}
+	return result
+}
+
 func action(cliCtx *cli.Context) error {
-	configPath := cliCtx.String("config")
+	configPath, _ := lookup(cliCtx, "config")
+	configOverrides := overrides(cliCtx)
 
-	config, err := factory.ReadConfig(configPath)
+	loadConfig := func() (*factory.Config, error) {
+		return factory.ReadConfig(configPath, configOverrides...)
+	}
+
+	config, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to read config: %w", err)
 	}
 
-	nfpcfApp, err := app.NewApp(config)
+	if len(configOverrides) > 0 {
+		sources := make([]string, 0, len(configOverrides))
+		for _, override := range configOverrides {
+			sources = append(sources, override.Source)
+		}
+		logger.MainLog.Infof("Config overridden by %s", strings.Join(sources, ", "))
+	}
+
+	nfpcfApp, err := app.NewApp(config, &app.ConfigSource{
+		Path: configPath,
+		Load: loadConfig,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create app: %w", err)
 	}
@@ -49,3 +133,21 @@ func action(cliCtx *cli.Context) error {
 
 	return nil
 }
+
+func validateConfig(cliCtx *cli.Context) error {
+	configPath, _ := lookup(cliCtx, "config")
+	config, err := factory.ReadConfig(configPath, overrides(cliCtx)...)
+	if err != nil {
+		return err
+	}
+
+	if cliCtx.Bool("print") {
+		effective, err := config.Redacted()
+		if err != nil {
+			return err
+		}
+		fmt.Print(effective)
+	}
+	fmt.Printf("%s: configuration is valid\n", configPath)
+	return nil
+}
@@ -0,0 +1,288 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/openapi/models"
+)
+
+type profileEntry struct {
+	Profile   *models.NrfNfDiscoveryNfProfile `json:"profile"`
+	ExpiresAt time.Time                       `json:"expiresAt"`
+}
+
+type searchResultEntry struct {
+	Key       string               `json:"key"`
+	Result    *models.SearchResult `json:"result"`
+	ExpiresAt time.Time            `json:"expiresAt"`
+}
+
+// ttls is exchanged as duration strings such as "5m" or "30s".
+type ttls struct {
+	TTL      string `json:"ttl"`
+	StaleTTL string `json:"staleTtl"`
+}
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+type purgeResult struct {
+	Purged int `json:"purged"`
+}
+
+func (s *Server) setupRoutes(mux *http.ServeMux) {
+	mux.HandleFunc(APIPrefix+"/profiles", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sendMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		s.handleListProfiles(w, r)
+	})
+
+	mux.HandleFunc(APIPrefix+"/profiles/", func(w http.ResponseWriter, r *http.Request) {
+		nfInstanceID, ok := resourceID(w, r, APIPrefix+"/profiles/")
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetProfile(w, nfInstanceID)
+		case http.MethodDelete:
+			s.handlePurgeInstance(w, nfInstanceID)
+		default:
+			sendMethodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+		}
+	})
+
+	mux.HandleFunc(APIPrefix+"/search-results", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sendMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		sendJSON(w, http.StatusOK, s.cache.SearchResults())
+	})
+
+	mux.HandleFunc(APIPrefix+"/search-results/", func(w http.ResponseWriter, r *http.Request) {
+		// Search keys contain ':' and '|' and are sent percent-encoded
+		key, ok := resourceID(w, r, APIPrefix+"/search-results/")
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetSearchResult(w, key)
+		case http.MethodDelete:
+			s.handlePurgeSearchResult(w, key)
+		default:
+			sendMethodNotAllowed(w, r, http.MethodGet, http.MethodDelete)
+		}
+	})
+
+	mux.HandleFunc(APIPrefix+"/cache", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			sendMethodNotAllowed(w, r, http.MethodDelete)
+			return
+		}
+		s.handlePurge(w, r)
+	})
+
+	mux.HandleFunc(APIPrefix+"/type-index", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sendMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+		sendJSON(w, http.StatusOK, s.cache.TypeIndex())
+	})
+
+	mux.HandleFunc(APIPrefix+"/ttl", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetTTLs(w)
+		case http.MethodPut:
+			s.handleSetTTLs(w, r)
+		default:
+			sendMethodNotAllowed(w, r, http.MethodGet, http.MethodPut)
+		}
+	})
+
+	mux.HandleFunc(APIPrefix+"/log-level", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			sendJSON(w, http.StatusOK, logLevel{Level: logger.Level()})
+		case http.MethodPut:
+			s.handleSetLogLevel(w, r)
+		default:
+			sendMethodNotAllowed(w, r, http.MethodGet, http.MethodPut)
+		}
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		sendProblem(w, http.StatusNotFound, "unknown admin resource")
+	})
+}
+
+// resourceID returns the unescaped path segment following prefix. It sends
+// 404 when there is none or when more segments follow.
+func resourceID(w http.ResponseWriter, r *http.Request, prefix string) (string, bool) {
+	escaped := strings.TrimPrefix(r.URL.EscapedPath(), prefix)
+	id, err := url.PathUnescape(escaped)
+	if escaped == "" || strings.Contains(escaped, "/") || err != nil {
+		sendProblem(w, http.StatusNotFound, "unknown admin resource")
+		return "", false
+	}
+	return id, true
+}
+
+func (s *Server) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	profiles := s.cache.Profiles()
+
+	if nfType := r.URL.Query().Get("nf-type"); nfType != "" {
+		filtered := make([]cache.ProfileInfo, 0, len(profiles))
+		for _, profile := range profiles {
+			if profile.NfType == nfType {
+				filtered = append(filtered, profile)
+			}
+		}
+		profiles = filtered
+	}
+
+	sendJSON(w, http.StatusOK, profiles)
+}
+
+func (s *Server) handleGetProfile(w http.ResponseWriter, nfInstanceID string) {
+	entry, found := s.cache.GetProfileEntry(nfInstanceID)
+	if !found {
+		sendProblem(w, http.StatusNotFound, fmt.Sprintf("no cached profile for %s", nfInstanceID))
+		return
+	}
+
+	sendJSON(w, http.StatusOK, profileEntry{Profile: entry.Profile, ExpiresAt: entry.ExpiresAt})
+}
+
+func (s *Server) handlePurgeInstance(w http.ResponseWriter, nfInstanceID string) {
+	if !s.cache.PurgeInstance(nfInstanceID) {
+		sendProblem(w, http.StatusNotFound, fmt.Sprintf("nothing cached for %s", nfInstanceID))
+		return
+	}
+
+	logger.AdminLog.Infof("Purged cached entries of NF instance %s", nfInstanceID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetSearchResult(w http.ResponseWriter, key string) {
+	entry, found := s.cache.GetSearchResultEntry(key)
+	if !found {
+		sendProblem(w, http.StatusNotFound, fmt.Sprintf("no cached search result for %q", key))
+		return
+	}
+
+	sendJSON(w, http.StatusOK, searchResultEntry{Key: key, Result: entry.Result, ExpiresAt: entry.ExpiresAt})
+}
+
+func (s *Server) handlePurgeSearchResult(w http.ResponseWriter, key string) {
+	if !s.cache.PurgeSearchResult(key) {
+		sendProblem(w, http.StatusNotFound, fmt.Sprintf("no cached search result for %q", key))
+		return
+	}
+
+	logger.AdminLog.Infof("Purged cached search result %q", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePurge purges the whole cache, or one NF type with ?nf-type=.
+func (s *Server) handlePurge(w http.ResponseWriter, r *http.Request) {
+	var purged int
+	if nfType := r.URL.Query().Get("nf-type"); nfType != "" {
+		purged = s.cache.PurgeNfType(nfType)
+		logger.AdminLog.Infof("Purged %d cached entries of NF type %s", purged, nfType)
+	} else {
+		purged = s.cache.PurgeAll()
+		logger.AdminLog.Infof("Purged the whole cache (%d entries)", purged)
+	}
+
+	sendJSON(w, http.StatusOK, purgeResult{Purged: purged})
+}
+
+func (s *Server) handleGetTTLs(w http.ResponseWriter) {
+	ttl, staleTTL := s.cache.TTLs()
+	sendJSON(w, http.StatusOK, ttls{TTL: ttl.String(), StaleTTL: staleTTL.String()})
+}
+
+// handleSetTTLs changes the TTLs given in the request; omitted ones are kept.
+func (s *Server) handleSetTTLs(w http.ResponseWriter, r *http.Request) {
+	var req ttls
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendProblem(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	ttl, staleTTL := s.cache.TTLs()
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			sendProblem(w, http.StatusBadRequest, fmt.Sprintf("invalid ttl: %v", err))
+			return
+		}
+		ttl = parsed
+	}
+	if req.StaleTTL != "" {
+		parsed, err := time.ParseDuration(req.StaleTTL)
+		if err != nil {
+			sendProblem(w, http.StatusBadRequest, fmt.Sprintf("invalid staleTtl: %v", err))
+			return
+		}
+		staleTTL = parsed
+	}
+
+	if err := s.cache.SetTTLs(ttl, staleTTL); err != nil {
+		sendProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger.AdminLog.Infof("Cache TTL set to %s, stale TTL to %s", ttl, staleTTL)
+	s.handleGetTTLs(w)
+}
+
+func (s *Server) handleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendProblem(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+
+	if err := logger.SetLevel(req.Level); err != nil {
+		sendProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	logger.AdminLog.Infof("Log level set to %s", logger.Level())
+	sendJSON(w, http.StatusOK, logLevel{Level: logger.Level()})
+}
+
+func sendJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func sendMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	sendProblem(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+}
+
+func sendProblem(w http.ResponseWriter, status int, detail string) {
+	sendJSON(w, status, models.ProblemDetails{
+		Status: int32(status),
+		Detail: detail,
+	})
+}
@@ -0,0 +1,122 @@
+// Package admin serves the cache administration API on its own listener.
+package admin
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/tlsutil"
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+// APIPrefix is the path prefix of all admin resources.
+const APIPrefix = "/admin/v1"
+
+type Server struct {
+	httpServer *http.Server
+	certs      *tlsutil.CertReloader
+	reload     time.Duration
+	cache      *cache.NFProfileCache
+	token      string
+}
+
+// NewServer creates the admin server. It requires TLS unless a token is set
+// and the server only listens on loopback.
+func NewServer(profileCache *cache.NFProfileCache, config *factory.Admin) (*Server, error) {
+	s := &Server{
+		cache: profileCache,
+		token: config.Token,
+	}
+
+	mux := http.NewServeMux()
+	s.setupRoutes(mux)
+	s.httpServer = &http.Server{
+		Addr:    config.BindAddr,
+		Handler: s.authenticate(mux),
+	}
+
+	tlsConfig := config.TLS
+	if tlsConfig == nil {
+		if s.token == "" {
+			return nil, fmt.Errorf("admin config: token or TLS with clientAuth require-and-verify is required")
+		}
+		if !config.Loopback() {
+			return nil, fmt.Errorf("admin config: TLS is required to send the token to %s", config.BindAddr)
+		}
+		return s, nil
+	}
+
+	minVersion, err := tlsutil.ParseVersion(tlsConfig.MinVersion)
+	if err != nil {
+		return nil, fmt.Errorf("admin TLS config: %w", err)
+	}
+
+	clientAuth, err := tlsutil.ParseClientAuth(tlsConfig.ClientAuth)
+	if err != nil {
+		return nil, fmt.Errorf("admin TLS config: %w", err)
+	}
+
+	if s.token == "" && clientAuth != tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("admin config: clientAuth must be require-and-verify when no token is set")
+	}
+
+	certs, err := tlsutil.NewCertReloader(tlsConfig.Cert, tlsConfig.Key, tlsConfig.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("admin TLS config: %w", err)
+	}
+
+	s.httpServer.TLSConfig = certs.ServerConfig(minVersion, clientAuth)
+	s.certs = certs
+	s.reload = tlsConfig.ReloadInterval
+
+	return s, nil
+}
+
+// authenticate accepts requests with a verified client certificate or with
+// the configured bearer token.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || s.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			logger.AdminLog.Warnf("Rejected unauthenticated %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="nfpcf-admin"`)
+			sendProblem(w, http.StatusUnauthorized, "missing or invalid admin token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) Run() error {
+	if s.certs == nil {
+		logger.AdminLog.Infof("NFPCF admin API listening on %s%s", s.httpServer.Addr, APIPrefix)
+		return s.httpServer.ListenAndServe()
+	}
+
+	if s.reload > 0 {
+		go s.certs.Watch(s.reload)
+	}
+
+	logger.AdminLog.Infof("NFPCF admin API listening on %s%s (TLS)", s.httpServer.Addr, APIPrefix)
+	// Certificates come from TLSConfig.GetConfigForClient
+	return s.httpServer.ListenAndServeTLS("", "")
+}
+
+func (s *Server) Shutdown() error {
+	if s.certs != nil {
+		s.certs.Stop()
+	}
+	return s.httpServer.Close()
+}
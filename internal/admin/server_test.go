@@ -0,0 +1,34 @@
+package admin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+func TestNewServer(t *testing.T) {
+	profileCache := cache.NewNFProfileCache(time.Minute, time.Minute, time.Second)
+	defer profileCache.Stop()
+
+	tests := []struct {
+		name    string
+		config  factory.Admin
+		wantErr bool
+	}{
+		{name: "token on loopback", config: factory.Admin{BindAddr: "127.0.0.1:9091", Token: "secret"}},
+		{name: "token on IPv6 loopback", config: factory.Admin{BindAddr: "[::1]:9091", Token: "secret"}},
+		{name: "no token", config: factory.Admin{BindAddr: "127.0.0.1:9091"}, wantErr: true},
+		{name: "token on all interfaces", config: factory.Admin{BindAddr: ":9091", Token: "secret"}, wantErr: true},
+		{name: "token on other address", config: factory.Admin{BindAddr: "10.0.0.1:9091", Token: "secret"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewServer(profileCache, &tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+type AccessTokenEntry struct {
+	Response  *models.NrfAccessTokenAccessTokenRsp
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// AccessTokenKey derives the cache key of an AccessTokenReq from the
+// verified peer and the form fields except grant_type.
+func AccessTokenKey(peer string, form url.Values) (string, bool) {
+	requester := form.Get("nfInstanceId")
+	if peer == "" || requester == "" {
+		return "", false
+	}
+
+	fields := url.Values{}
+	for name, values := range form {
+		if name == "grant_type" || name == "nfInstanceId" {
+			continue
+		}
+		fields[name] = append([]string(nil), values...)
+	}
+
+	// Scopes are a space separated set
+	if scope := fields.Get("scope"); scope != "" {
+		scopes := strings.Fields(scope)
+		sort.Strings(scopes)
+		fields.Set("scope", strings.Join(dedupe(scopes), " "))
+	}
+
+	return peer + "|" + requester + "|" + fields.Encode(), true
+}
+
+// GetAccessToken returns a cached token response with expires_in reduced to
+// the remaining lifetime of the token.
+func (c *NFProfileCache) GetAccessToken(key string) (*models.NrfAccessTokenAccessTokenRsp, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry, exists := c.accessTokens[key]
+	if !exists {
+		return nil, false
+	}
+
+	now := time.Now()
+	if now.After(entry.ExpiresAt) {
+		return nil, false
+	}
+
+	rsp := *entry.Response
+	rsp.ExpiresIn -= int32(now.Sub(entry.IssuedAt) / time.Second)
+	return &rsp, true
+}
+
+// SetAccessToken caches a token response until tokenMargin before it expires.
+func (c *NFProfileCache) SetAccessToken(key string, rsp *models.NrfAccessTokenAccessTokenRsp) {
+	lifetime := time.Duration(rsp.ExpiresIn)*time.Second - c.tokenMargin
+	if lifetime <= 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	c.accessTokens[key] = &AccessTokenEntry{
+		Response:  rsp,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(lifetime),
+	}
+}
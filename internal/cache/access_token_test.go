@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestAccessTokenKey(t *testing.T) {
+	form := url.Values{
+		"grant_type":   {"client_credentials"},
+		"nfInstanceId": {"amf-1"},
+		"scope":        {"nsmf-pdusession nudm-sdm"},
+	}
+	key, ok := AccessTokenKey("peer-a", form)
+	if !ok {
+		t.Fatal("verified request not cacheable")
+	}
+
+	reordered := url.Values{
+		"grant_type":   {"client_credentials"},
+		"nfInstanceId": {"amf-1"},
+		"scope":        {"nudm-sdm nsmf-pdusession nudm-sdm"},
+	}
+	tests := []struct {
+		name      string
+		peer      string
+		form      url.Values
+		cacheable bool
+		sameKey   bool
+	}{
+		{"scope order and duplicates are ignored", "peer-a", reordered, true, true},
+		{"other peer", "peer-b", form, true, false},
+		{"no verified peer", "", form, false, false},
+		{"no nfInstanceId", "peer-a", url.Values{"scope": {"nudm-sdm"}}, false, false},
+		{"other scope", "peer-a", url.Values{"nfInstanceId": {"amf-1"}, "scope": {"nudm-sdm"}}, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := AccessTokenKey(tt.peer, tt.form)
+			if ok != tt.cacheable {
+				t.Fatalf("cacheable = %v, want %v", ok, tt.cacheable)
+			}
+			if ok && (got == key) != tt.sameKey {
+				t.Errorf("key %q vs %q, same = %v", got, key, got == key)
+			}
+		})
+	}
+}
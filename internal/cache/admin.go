@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+// ProfileInfo summarizes a cached NF profile for the admin API.
+type ProfileInfo struct {
+	NfInstanceID string    `json:"nfInstanceId"`
+	NfType       string    `json:"nfType"`
+	NfStatus     string    `json:"nfStatus"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// SearchResultInfo summarizes a cached discovery result for the admin API.
+type SearchResultInfo struct {
+	Key          string    `json:"key"`
+	TargetNfType string    `json:"targetNfType"`
+	Instances    int       `json:"instances"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
+
+// Profiles lists the cached profiles, expired or not, ordered by instance ID.
+func (c *NFProfileCache) Profiles() []ProfileInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	profiles := make([]ProfileInfo, 0, len(c.profiles))
+	for id, entry := range c.profiles {
+		profiles = append(profiles, ProfileInfo{
+			NfInstanceID: id,
+			NfType:       string(entry.Profile.NfType),
+			NfStatus:     string(entry.Profile.NfStatus),
+			ExpiresAt:    entry.ExpiresAt,
+		})
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].NfInstanceID < profiles[j].NfInstanceID
+	})
+	return profiles
+}
+
+// SearchResults lists the cached discovery results, including the stale
+// ones, ordered by search key.
+func (c *NFProfileCache) SearchResults() []SearchResultInfo {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	results := make([]SearchResultInfo, 0, len(c.searchResults))
+	for key, entry := range c.searchResults {
+		results = append(results, SearchResultInfo{
+			Key:          key,
+			TargetNfType: searchKeyTargetNfType(key),
+			Instances:    len(entry.Result.NfInstances),
+			ExpiresAt:    entry.ExpiresAt,
+		})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Key < results[j].Key
+	})
+	return results
+}
+
+// GetProfileEntry returns the cached entry of an instance even if it expired.
+func (c *NFProfileCache) GetProfileEntry(nfInstanceID string) (CacheEntry, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry, exists := c.profiles[nfInstanceID]
+	if !exists {
+		return CacheEntry{}, false
+	}
+	return *entry, true
+}
+
+// GetSearchResultEntry returns the discovery result cached under a search
+// key, as listed by SearchResults, even if it expired.
+func (c *NFProfileCache) GetSearchResultEntry(key string) (SearchResultEntry, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry, exists := c.searchResults[key]
+	if !exists {
+		return SearchResultEntry{}, false
+	}
+	return *entry, true
+}
+
+// TypeIndex returns a copy of the NF type index.
+func (c *NFProfileCache) TypeIndex() map[string][]string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	index := make(map[string][]string, len(c.typeIndex))
+	for nfType, ids := range c.typeIndex {
+		index[nfType] = append([]string(nil), ids...)
+	}
+	return index
+}
+
+// PurgeAll drops all cached entries except instance states and returns how
+// many were removed.
+func (c *NFProfileCache) PurgeAll() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	purged := len(c.profiles) + len(c.searchResults) + len(c.storedSearches) +
+		len(c.searchOrigins) + len(c.localSearches) + len(c.nfLists) + len(c.accessTokens)
+	clear(c.profiles)
+	clear(c.typeIndex)
+	clear(c.searchResults)
+	clear(c.storedSearches)
+	clear(c.searchOrigins)
+	clear(c.localSearches)
+	clear(c.nfLists)
+	clear(c.accessTokens)
+	return purged
+}
+
+// PurgeNfType drops the cached entries of an NF type and returns how many
+// were removed.
+func (c *NFProfileCache) PurgeNfType(nfType string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	purged := 0
+	for _, id := range c.typeIndex[nfType] {
+		delete(c.profiles, id)
+		purged++
+	}
+	delete(c.typeIndex, nfType)
+
+	matches := func(instances []models.NrfNfDiscoveryNfProfile) bool {
+		for _, profile := range instances {
+			if string(profile.NfType) == nfType {
+				return true
+			}
+		}
+		return false
+	}
+
+	for key, entry := range c.searchResults {
+		if searchKeyTargetNfType(key) == nfType || matches(entry.Result.NfInstances) {
+			delete(c.searchResults, key)
+			purged++
+		}
+	}
+	for key, entry := range c.storedSearches {
+		if matches(entry.Result.NfInstances) {
+			delete(c.storedSearches, key)
+			purged++
+		}
+	}
+
+	purged += len(c.nfLists)
+	clear(c.nfLists)
+	return purged
+}
+
+// PurgeInstance drops the profile of an instance and every result containing
+// it, and reports whether anything was cached.
+func (c *NFProfileCache) PurgeInstance(nfInstanceID string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	found := false
+	if entry, exists := c.profiles[nfInstanceID]; exists {
+		if entry.Profile.NfType != "" {
+			c.removeFromTypeIndex(string(entry.Profile.NfType), nfInstanceID)
+		}
+		delete(c.profiles, nfInstanceID)
+		found = true
+	}
+
+	contains := func(instances []models.NrfNfDiscoveryNfProfile) bool {
+		for _, profile := range instances {
+			if profile.NfInstanceId == nfInstanceID {
+				return true
+			}
+		}
+		return false
+	}
+
+	for key, entry := range c.searchResults {
+		if contains(entry.Result.NfInstances) {
+			delete(c.searchResults, key)
+			found = true
+		}
+	}
+	for key, entry := range c.storedSearches {
+		if contains(entry.Result.NfInstances) {
+			delete(c.storedSearches, key)
+			found = true
+		}
+	}
+
+	clear(c.nfLists)
+	return found
+}
+
+// PurgeSearchResult drops the discovery result cached under a search key
+// and reports whether it existed.
+func (c *NFProfileCache) PurgeSearchResult(key string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, exists := c.searchResults[key]; !exists {
+		return false
+	}
+	delete(c.searchResults, key)
+	return true
+}
+
+// TTLs returns the lifetime of new entries matching no TTL policy and the
+// time expired discovery results are kept for stale answers.
+func (c *NFProfileCache) TTLs() (ttl time.Duration, staleTTL time.Duration) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.defaultTTL, c.staleTTL
+}
+
+// SetTTLs changes the lifetime of entries cached from now on.
+func (c *NFProfileCache) SetTTLs(ttl time.Duration, staleTTL time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive, got %s", ttl)
+	}
+	if staleTTL < 0 {
+		return fmt.Errorf("staleTtl must not be negative, got %s", staleTTL)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.defaultTTL = ttl
+	c.staleTTL = staleTTL
+	c.cleanupTimer.Reset(cleanupInterval(c.shortestTTLLocked()))
+	return nil
+}
+
+// searchKeyTargetNfType extracts the target-nf-type from a key built by
+// generateSearchKey.
+func searchKeyTargetNfType(key string) string {
+	if strings.HasPrefix(key, "plmn=") {
+		if _, rest, found := strings.Cut(key, "|"); found {
+			key = rest
+		}
+	}
+	targetNfType, _, _ := strings.Cut(key, ":")
+	return targetNfType
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func TestPurgeAll(t *testing.T) {
+	c := NewNFProfileCache(time.Minute, 0, 0)
+	defer c.Stop()
+
+	smf := smfProfile("smf-1", "internet")
+	c.Put(&smf)
+	query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+	instances := []models.NrfNfDiscoveryNfProfile{smf, smfProfile("smf-2", "ims")}
+	c.SetSearchResult(query, "001-01", &models.SearchResult{SearchId: "remote-search", NfInstances: instances})
+	localID, _, err := c.StoreLocalSearch(query, instances, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// profile, search result, origin, local search and its two pages
+	if purged := c.PurgeAll(); purged != 6 {
+		t.Errorf("PurgeAll() = %d, want 6", purged)
+	}
+
+	tests := []struct {
+		name  string
+		found func() bool
+	}{
+		{"profile", func() bool { _, found := c.Get("smf-1"); return found }},
+		{"search result", func() bool { _, found := c.GetSearchResult(query); return found }},
+		{"search origin", func() bool { _, found := c.SearchOrigin("remote-search"); return found }},
+		{"local search page", func() bool { _, found := c.GetStoredSearch(localID, false); return found }},
+		{"complete local search", func() bool { _, found := c.GetStoredSearch(localID, true); return found }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.found() {
+				t.Errorf("%s survived the purge", tt.name)
+			}
+		})
+	}
+
+	if _, _, err := c.StoreLocalSearch(query, instances, 1); err != nil {
+		t.Fatal(err)
+	}
+	if purged := c.PurgeAll(); purged != 3 {
+		t.Errorf("second PurgeAll() = %d, want the new local search only (3)", purged)
+	}
+}
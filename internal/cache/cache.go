@@ -1,8 +1,14 @@
 package cache
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -19,22 +25,70 @@ type SearchResultEntry struct {
 	ExpiresAt time.Time
 }
 
+type StoredSearchEntry struct {
+	Result    *models.StoredSearchResult
+	ExpiresAt time.Time
+}
+
+// searchOrigin records the NRF and TTL of the discovery a searchId came from.
+type searchOrigin struct {
+	nrf       string
+	ttl       time.Duration
+	expiresAt time.Time
+}
+
+// LocalSearchIDPrefix marks searchIds generated by NFPCF itself. Such
+// searches only exist in the cache and are never forwarded to the NRF.
+const LocalSearchIDPrefix = "nfpcf-"
+
 type NFProfileCache struct {
 	profiles       map[string]*CacheEntry
 	typeIndex      map[string][]string
 	searchResults  map[string]*SearchResultEntry
+	storedSearches map[string]*StoredSearchEntry
+	searchOrigins  map[string]*searchOrigin
+	localSearches  map[string]string
+	instanceStates map[string]*InstanceState
+	statusChanges  map[string]map[string]uint64
+	accessTokens   map[string]*AccessTokenEntry
+	nfLists        map[string]*NFListEntry
+	evictions      map[string]uint64
 	lock           sync.RWMutex
 	defaultTTL     time.Duration
+	staleTTL       time.Duration
+	ttlPolicies    []TTLPolicy
+	tokenMargin    time.Duration
 	cleanupTimer   *time.Ticker
 }
 
-func NewNFProfileCache(ttl time.Duration) *NFProfileCache {
+// minCleanupInterval bounds how often expired entries are removed, and keeps
+// the interval positive for a zero or negative ttl.
+const minCleanupInterval = time.Second
+
+// cleanupInterval removes expired entries twice per ttl.
+func cleanupInterval(ttl time.Duration) time.Duration {
+	return max(ttl/2, minCleanupInterval)
+}
+
+// NewNFProfileCache creates a cache whose entries live for ttl unless a TTL
+// policy matches them.
+func NewNFProfileCache(ttl time.Duration, staleTTL time.Duration, tokenMargin time.Duration) *NFProfileCache {
 	cache := &NFProfileCache{
-		profiles:      make(map[string]*CacheEntry),
-		typeIndex:     make(map[string][]string),
-		searchResults: make(map[string]*SearchResultEntry),
-		defaultTTL:    ttl,
-		cleanupTimer:  time.NewTicker(ttl / 2),
+		profiles:       make(map[string]*CacheEntry),
+		typeIndex:      make(map[string][]string),
+		searchResults:  make(map[string]*SearchResultEntry),
+		storedSearches: make(map[string]*StoredSearchEntry),
+		searchOrigins:  make(map[string]*searchOrigin),
+		localSearches:  make(map[string]string),
+		instanceStates: make(map[string]*InstanceState),
+		statusChanges:  make(map[string]map[string]uint64),
+		accessTokens:   make(map[string]*AccessTokenEntry),
+		nfLists:        make(map[string]*NFListEntry),
+		evictions:      make(map[string]uint64),
+		defaultTTL:     ttl,
+		staleTTL:       staleTTL,
+		tokenMargin:    tokenMargin,
+		cleanupTimer:   time.NewTicker(cleanupInterval(ttl)),
 	}
 
 	go cache.cleanupExpired()
@@ -48,7 +102,7 @@ func (c *NFProfileCache) Put(profile *models.NrfNfDiscoveryNfProfile) {
 	nfInstanceID := profile.NfInstanceId
 	entry := &CacheEntry{
 		Profile:   profile,
-		ExpiresAt: time.Now().Add(c.defaultTTL),
+		ExpiresAt: time.Now().Add(c.profileTTLLocked(string(profile.NfType))),
 	}
 
 	c.profiles[nfInstanceID] = entry
@@ -56,6 +110,8 @@ func (c *NFProfileCache) Put(profile *models.NrfNfDiscoveryNfProfile) {
 	if profile.NfType != "" {
 		c.addToTypeIndex(string(profile.NfType), nfInstanceID)
 	}
+
+	c.observeProfilesLocked([]models.NrfNfDiscoveryNfProfile{*profile})
 }
 
 func (c *NFProfileCache) Get(nfInstanceID string) (*models.NrfNfDiscoveryNfProfile, bool) {
@@ -97,6 +153,16 @@ func (c *NFProfileCache) Search(queryParams url.Values) []*models.NrfNfDiscovery
 		return results
 	}
 
+	var complexQuery *ComplexQuery
+	if raw := queryParams.Get("complex-query"); raw != "" {
+		parsed, err := ParseComplexQuery(raw)
+		if err != nil || !parsed.evaluable() {
+			// Leave invalid or unsupported expressions to the NRF
+			return results
+		}
+		complexQuery = parsed
+	}
+
 	instanceIDs, exists := c.typeIndex[targetNfType]
 	if !exists {
 		return results
@@ -109,32 +175,45 @@ func (c *NFProfileCache) Search(queryParams url.Values) []*models.NrfNfDiscovery
 			continue
 		}
 
-		if c.matchesQuery(entry.Profile, queryParams) {
-			results = append(results, entry.Profile)
+		if !c.matchesQuery(entry.Profile, queryParams) {
+			continue
+		}
+
+		if complexQuery != nil {
+			matched, known := complexQuery.evaluate(func(attr string, values []string) paramMatch {
+				return c.matchesParam(entry.Profile, attr, values)
+			})
+			if !known {
+				// Leave the discovery to the NRF rather than answer it partially
+				return nil
+			}
+			if !matched {
+				continue
+			}
 		}
+
+		results = append(results, entry.Profile)
 	}
 
 	return results
 }
 
+// matchedQueryParams lists the query parameters the cache is able to evaluate.
+var matchedQueryParams = []string{"snssais", "dnn", "target-plmn-list", "target-nf-instance-id"}
+
 func (c *NFProfileCache) matchesQuery(
 	profile *models.NrfNfDiscoveryNfProfile,
 	queryParams url.Values,
 ) bool {
-	if requesterNfType := queryParams.Get("requester-nf-type"); requesterNfType != "" {
-		if !c.matchesNfType(profile, requesterNfType) {
-			return false
-		}
-	}
-
-	if snssais := queryParams["snssais"]; len(snssais) > 0 {
-		if !c.matchesSnssais(profile, snssais) {
-			return false
+	for _, name := range matchedQueryParams {
+		values := queryParams[name]
+		if len(values) == 0 || values[0] == "" {
+			continue
 		}
-	}
 
-	if dnn := queryParams.Get("dnn"); dnn != "" {
-		if !c.matchesDnn(profile, dnn) {
+		// Profiles without the attribute match any slice or DNN, but no PLMN
+		result := c.matchesParam(profile, name, values)
+		if result == paramMismatch || (result == paramUnknown && name == "target-plmn-list") {
 			return false
 		}
 	}
@@ -142,11 +221,53 @@ func (c *NFProfileCache) matchesQuery(
 	return true
 }
 
-func (c *NFProfileCache) matchesNfType(
+// paramMatch is the result of evaluating a query parameter against a profile.
+type paramMatch int
+
+const (
+	paramMismatch paramMatch = iota
+	paramMatched
+	// paramUnknown means the profile lacks the attribute the NRF would check,
+	// e.g. the DNNs of an NF type other than SMF.
+	paramUnknown
+)
+
+func matchResult(matched bool) paramMatch {
+	if matched {
+		return paramMatched
+	}
+	return paramMismatch
+}
+
+// matchesParam evaluates a query parameter against a profile.
+func (c *NFProfileCache) matchesParam(
 	profile *models.NrfNfDiscoveryNfProfile,
-	requesterNfType string,
-) bool {
-	return true
+	name string,
+	values []string,
+) paramMatch {
+	switch name {
+	case "snssais":
+		if len(profile.SNssais) == 0 {
+			return paramUnknown
+		}
+		return matchResult(c.matchesSnssais(profile, values))
+	case "dnn":
+		if profile.SmfInfo == nil || profile.SmfInfo.SNssaiSmfInfoList == nil {
+			return paramUnknown
+		}
+		return matchResult(slices.ContainsFunc(values, func(dnn string) bool {
+			return c.matchesDnn(profile, dnn)
+		}))
+	case "target-plmn-list":
+		if len(profile.PlmnList) == 0 {
+			return paramUnknown
+		}
+		return matchResult(c.matchesPlmnList(profile, values))
+	case "target-nf-instance-id":
+		return matchResult(slices.Contains(values, profile.NfInstanceId))
+	}
+
+	return paramUnknown
 }
 
 func (c *NFProfileCache) matchesSnssais(
@@ -157,9 +278,13 @@ func (c *NFProfileCache) matchesSnssais(
 		return true
 	}
 
-	for _, querySnssai := range querySnssais {
+	snssais, err := parseSnssais(querySnssais)
+	if err != nil {
+		return false
+	}
+	for _, querySnssai := range snssais {
 		for _, profileSnssai := range profile.SNssais {
-			if c.snssaiEquals(&profileSnssai, querySnssai) {
+			if snssaiEquals(&profileSnssai, querySnssai) {
 				return true
 			}
 		}
@@ -167,6 +292,25 @@ func (c *NFProfileCache) matchesSnssais(
 	return false
 }
 
+// parseSnssais decodes S-NSSAIs given as a JSON array (query parameter) or
+// one JSON object per value (complex-query atom).
+func parseSnssais(values []string) ([]models.Snssai, error) {
+	var snssais []models.Snssai
+	for _, value := range values {
+		var list []models.Snssai
+		if err := json.Unmarshal([]byte(value), &list); err == nil {
+			snssais = append(snssais, list...)
+			continue
+		}
+		var snssai models.Snssai
+		if err := json.Unmarshal([]byte(value), &snssai); err != nil {
+			return nil, fmt.Errorf("invalid snssai %q", value)
+		}
+		snssais = append(snssais, snssai)
+	}
+	return snssais, nil
+}
+
 func (c *NFProfileCache) matchesDnn(profile *models.NrfNfDiscoveryNfProfile, queryDnn string) bool {
 	if profile.SmfInfo == nil || profile.SmfInfo.SNssaiSmfInfoList == nil {
 		return true
@@ -184,11 +328,30 @@ func (c *NFProfileCache) matchesDnn(profile *models.NrfNfDiscoveryNfProfile, que
 	return false
 }
 
-func (c *NFProfileCache) snssaiEquals(
-	profileSnssai *models.ExtSnssai,
-	querySnssai string,
-) bool {
-	return true
+// matchesPlmnList requires the profile to serve one of the target PLMNs.
+func (c *NFProfileCache) matchesPlmnList(profile *models.NrfNfDiscoveryNfProfile, queryPlmns []string) bool {
+	targetPlmns, err := ParsePlmnList(queryPlmns)
+	if err != nil || len(profile.PlmnList) == 0 {
+		return false
+	}
+
+	for _, target := range targetPlmns {
+		for _, plmn := range profile.PlmnList {
+			if plmn.Mcc == target.Mcc && plmn.Mnc == target.Mnc {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snssaiEquals matches an S-NSSAI of a profile; a query without sd matches
+// any sd of the slice type.
+func snssaiEquals(profileSnssai *models.ExtSnssai, query models.Snssai) bool {
+	if profileSnssai.Sst != query.Sst {
+		return false
+	}
+	return query.Sd == "" || profileSnssai.WildcardSd || strings.EqualFold(profileSnssai.Sd, query.Sd)
 }
 
 func (c *NFProfileCache) addToTypeIndex(nfType string, nfInstanceID string) {
@@ -232,42 +395,313 @@ func (c *NFProfileCache) GetSearchResult(queryParams url.Values) (*models.Search
 	return entry.Result, true
 }
 
-func (c *NFProfileCache) SetSearchResult(queryParams url.Values, result *models.SearchResult) {
+// GetStaleSearchResult returns a search result even if it expired less than
+// staleTTL ago. It is meant for answering while the NRF is unavailable.
+func (c *NFProfileCache) GetStaleSearchResult(queryParams url.Values) (*models.SearchResult, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry, exists := c.searchResults[generateSearchKey(queryParams)]
+	if !exists {
+		return nil, false
+	}
+
+	if time.Now().After(entry.ExpiresAt.Add(c.staleTTL)) {
+		return nil, false
+	}
+
+	return entry.Result, true
+}
+
+// SetSearchResult caches a discovery result of the NRF named nrf. Truncated
+// results are not cached.
+func (c *NFProfileCache) SetSearchResult(queryParams url.Values, nrf string, result *models.SearchResult) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	key := generateSearchKey(queryParams)
-	entry := &SearchResultEntry{
+	ttl := c.searchTTLLocked(queryParams)
+	expiresAt := time.Now().Add(ttl)
+	if !truncated(queryParams, result) {
+		c.searchResults[generateSearchKey(queryParams)] = &SearchResultEntry{
+			Result:    result,
+			ExpiresAt: expiresAt,
+		}
+	}
+
+	if result.SearchId != "" {
+		c.searchOrigins[result.SearchId] = &searchOrigin{
+			nrf:       nrf,
+			ttl:       ttl,
+			expiresAt: expiresAt.Add(c.staleTTL),
+		}
+	}
+
+	c.observeProfilesLocked(result.NfInstances)
+}
+
+// GetStoredSearch returns the stored search identified by searchID. When
+// complete is true the complete result (complete-stored-search) is returned.
+func (c *NFProfileCache) GetStoredSearch(searchID string, complete bool) (*models.StoredSearchResult, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry, exists := c.storedSearches[storedSearchKey(searchID, complete)]
+	if !exists {
+		return nil, false
+	}
+
+	if time.Now().After(entry.ExpiresAt) {
+		return nil, false
+	}
+
+	return entry.Result, true
+}
+
+// SearchOrigin returns the NRF that returned searchID.
+func (c *NFProfileCache) SearchOrigin(searchID string) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	origin, exists := c.searchOrigins[searchID]
+	if !exists {
+		return "", false
+	}
+	return origin.nrf, true
+}
+
+// SetStoredSearch caches a stored search retrieved from the NRF for the TTL
+// of the discovery that returned its searchId.
+func (c *NFProfileCache) SetStoredSearch(searchID string, complete bool, result *models.StoredSearchResult) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ttl := c.defaultTTL
+	if origin, exists := c.searchOrigins[searchID]; exists {
+		ttl = origin.ttl
+	}
+
+	c.storedSearches[storedSearchKey(searchID, complete)] = &StoredSearchEntry{
 		Result:    result,
-		ExpiresAt: time.Now().Add(c.defaultTTL),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+}
+
+// truncated reports whether the NRF left instances out of result.
+func truncated(queryParams url.Values, result *models.SearchResult) bool {
+	returned := len(result.NfInstances)
+	if int(result.NumNfInstComplete) > returned {
+		return true
+	}
+	limit, err := strconv.Atoi(queryParams.Get("limit"))
+	return err == nil && limit > 0 && returned >= limit && int(result.NumNfInstComplete) != returned
+}
+
+// StoreLocalSearch stores instances under an NFPCF-local searchId, shared by
+// discoveries with the same query, limit and instances.
+func (c *NFProfileCache) StoreLocalSearch(
+	queryParams url.Values,
+	instances []models.NrfNfDiscoveryNfProfile,
+	limit int,
+) (string, []models.NrfNfDiscoveryNfProfile, error) {
+	key := generateSearchKey(queryParams) + ":limit=" + strconv.Itoa(limit)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if searchID, exists := c.localSearches[key]; exists {
+		entry, exists := c.storedSearches[storedSearchKey(searchID, true)]
+		if exists && time.Now().Before(entry.ExpiresAt) && sameInstances(entry.Result.NfInstances, instances) {
+			return searchID, entry.Result.NfInstances, nil
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate searchId: %w", err)
+	}
+	searchID := LocalSearchIDPrefix + hex.EncodeToString(buf)
+
+	expiresAt := time.Now().Add(c.searchTTLLocked(queryParams))
+	c.storedSearches[storedSearchKey(searchID, false)] = &StoredSearchEntry{
+		Result:    &models.StoredSearchResult{NfInstances: instances[limit:]},
+		ExpiresAt: expiresAt,
 	}
-	c.searchResults[key] = entry
+	c.storedSearches[storedSearchKey(searchID, true)] = &StoredSearchEntry{
+		Result:    &models.StoredSearchResult{NfInstances: instances},
+		ExpiresAt: expiresAt,
+	}
+	c.localSearches[key] = searchID
+
+	return searchID, instances, nil
+}
+
+// sameInstances reports whether a and b hold the same NF instances in any
+// order.
+func sameInstances(a, b []models.NrfNfDiscoveryNfProfile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ids := make(map[string]int, len(a))
+	for i := range a {
+		ids[a[i].NfInstanceId]++
+	}
+	for i := range b {
+		if ids[b[i].NfInstanceId] == 0 {
+			return false
+		}
+		ids[b[i].NfInstanceId]--
+	}
+	return true
+}
+
+func storedSearchKey(searchID string, complete bool) string {
+	if complete {
+		return searchID + "/complete"
+	}
+	return searchID
 }
 
 func generateSearchKey(queryParams url.Values) string {
 	targetNfType := queryParams.Get("target-nf-type")
 	requesterNfType := queryParams.Get("requester-nf-type")
-	return fmt.Sprintf("%s:%s", targetNfType, requesterNfType)
+	key := fmt.Sprintf("%s:%s", targetNfType, requesterNfType)
+
+	// Each target PLMN has its own namespace, so roaming discoveries are never
+	// answered from home-PLMN entries (which have no target-plmn-list).
+	if targetPlmns := queryParams["target-plmn-list"]; len(targetPlmns) > 0 {
+		key = "plmn=" + plmnListKey(targetPlmns) + "|" + key
+	}
+	if requesterPlmns := queryParams["requester-plmn-list"]; len(requesterPlmns) > 0 {
+		key += ":requester-plmn=" + plmnListKey(requesterPlmns)
+	}
+
+	if raw := queryParams.Get("complex-query"); raw != "" {
+		if complexQuery, err := ParseComplexQuery(raw); err == nil {
+			key += ":" + complexQuery.Canonical()
+		} else {
+			key += ":" + raw
+		}
+	}
+
+	// The NRF filters on every other parameter too
+	other := url.Values{}
+	for name, values := range queryParams {
+		if !searchKeyParams[name] {
+			other[name] = values
+		}
+	}
+	if len(other) > 0 {
+		key += ":" + other.Encode()
+	}
+
+	return key
+}
+
+// searchKeyParams are the query parameters generateSearchKey handles itself
+// or that only shape the response.
+var searchKeyParams = map[string]bool{
+	"target-nf-type":      true,
+	"requester-nf-type":   true,
+	"target-plmn-list":    true,
+	"requester-plmn-list": true,
+	"complex-query":       true,
+	"limit":               true,
+}
+
+// GetComplexQueryResult filters the cached result of the same discovery
+// without complex-query, unless an atom cannot be decided for an instance.
+func (c *NFProfileCache) GetComplexQueryResult(queryParams url.Values) (*models.SearchResult, bool) {
+	complexQuery, err := ParseComplexQuery(queryParams.Get("complex-query"))
+	if err != nil || !complexQuery.evaluable() {
+		return nil, false
+	}
+
+	base := url.Values{}
+	for name, values := range queryParams {
+		if name != "complex-query" {
+			base[name] = values
+		}
+	}
+	result, found := c.GetSearchResult(base)
+	if !found {
+		return nil, false
+	}
+
+	filtered := *result
+	filtered.NfInstances = nil
+	for i := range result.NfInstances {
+		profile := &result.NfInstances[i]
+		matched, known := complexQuery.evaluate(func(attr string, values []string) paramMatch {
+			return c.matchesParam(profile, attr, values)
+		})
+		if !known {
+			return nil, false
+		}
+		if matched {
+			filtered.NfInstances = append(filtered.NfInstances, *profile)
+		}
+	}
+	return &filtered, true
 }
 
 func (c *NFProfileCache) cleanupExpired() {
 	for range c.cleanupTimer.C {
 		c.lock.Lock()
-		now := time.Now()
-		for id, entry := range c.profiles {
-			if now.After(entry.ExpiresAt) {
-				if entry.Profile.NfType != "" {
-					c.removeFromTypeIndex(string(entry.Profile.NfType), id)
-				}
-				delete(c.profiles, id)
+		c.removeExpiredLocked(time.Now())
+		c.lock.Unlock()
+	}
+}
+
+func (c *NFProfileCache) removeExpiredLocked(now time.Time) {
+	for id, entry := range c.profiles {
+		if now.After(entry.ExpiresAt) {
+			if entry.Profile.NfType != "" {
+				c.removeFromTypeIndex(string(entry.Profile.NfType), id)
 			}
+			delete(c.profiles, id)
+			c.evictions[mapProfiles]++
 		}
-		for key, entry := range c.searchResults {
-			if now.After(entry.ExpiresAt) {
-				delete(c.searchResults, key)
-			}
+	}
+	for key, entry := range c.searchResults {
+		if now.After(entry.ExpiresAt.Add(c.staleTTL)) {
+			delete(c.searchResults, key)
+			c.evictions[mapSearchResults]++
+		}
+	}
+	for key, entry := range c.storedSearches {
+		if now.After(entry.ExpiresAt) {
+			delete(c.storedSearches, key)
+			c.evictions[mapStoredSearches]++
+		}
+	}
+	for key, entry := range c.accessTokens {
+		if now.After(entry.ExpiresAt) {
+			delete(c.accessTokens, key)
+			c.evictions[mapAccessTokens]++
+		}
+	}
+	for key, entry := range c.nfLists {
+		if now.After(entry.ExpiresAt) {
+			delete(c.nfLists, key)
+			c.evictions[mapNFLists]++
+		}
+	}
+	for key, searchID := range c.localSearches {
+		if _, exists := c.storedSearches[storedSearchKey(searchID, true)]; !exists {
+			delete(c.localSearches, key)
+		}
+	}
+	for searchID, origin := range c.searchOrigins {
+		if now.After(origin.expiresAt) {
+			delete(c.searchOrigins, searchID)
+		}
+	}
+	// States outlive every entry cached before they were last updated
+	retention := c.longestTTLLocked() + c.staleTTL
+	for id, state := range c.instanceStates {
+		if now.Sub(state.UpdatedAt) > retention {
+			delete(c.instanceStates, id)
 		}
-		c.lock.Unlock()
 	}
 }
 
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func instances(ids ...string) []models.NrfNfDiscoveryNfProfile {
+	profiles := make([]models.NrfNfDiscoveryNfProfile, len(ids))
+	for i, id := range ids {
+		profiles[i] = models.NrfNfDiscoveryNfProfile{NfInstanceId: id, NfType: "SMF"}
+	}
+	return profiles
+}
+
+func TestSetSearchResultSkipsTruncated(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  url.Values
+		result *models.SearchResult
+		cached bool
+	}{
+		{"complete", url.Values{}, &models.SearchResult{NfInstances: instances("a", "b")}, true},
+		{"below limit", url.Values{"limit": {"5"}}, &models.SearchResult{NfInstances: instances("a", "b")}, true},
+		{"at limit", url.Values{"limit": {"2"}}, &models.SearchResult{NfInstances: instances("a", "b")}, false},
+		{"at limit and complete", url.Values{"limit": {"2"}}, &models.SearchResult{NfInstances: instances("a", "b"), NumNfInstComplete: 2}, true},
+		{"fewer than complete", url.Values{}, &models.SearchResult{NfInstances: instances("a"), NumNfInstComplete: 3}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewNFProfileCache(time.Minute, time.Minute, time.Second)
+			defer c.Stop()
+
+			query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+			for name, values := range tt.query {
+				query[name] = values
+			}
+			c.SetSearchResult(query, "", tt.result)
+
+			other := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}, "limit": {"50"}}
+			if _, cached := c.GetSearchResult(other); cached != tt.cached {
+				t.Errorf("cached = %v, want %v", cached, tt.cached)
+			}
+		})
+	}
+}
+
+func TestStoreLocalSearch(t *testing.T) {
+	query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+	c := NewNFProfileCache(time.Minute, time.Minute, time.Second)
+	defer c.Stop()
+
+	firstID, first, err := c.StoreLocalSearch(query, instances("a", "b", "c"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		instances []models.NrfNfDiscoveryNfProfile
+		limit     int
+		sameID    bool
+	}{
+		{"same instances in another order", instances("c", "a", "b"), 1, true},
+		{"other limit", instances("a", "b", "c"), 2, false},
+		{"instance removed", instances("a", "b"), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := len(c.storedSearches)
+			searchID, got, err := c.StoreLocalSearch(query, tt.instances, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (searchID == firstID) != tt.sameID {
+				t.Errorf("searchId %s, first %s, want same = %v", searchID, firstID, tt.sameID)
+			}
+			if tt.sameID {
+				if len(c.storedSearches) != stored {
+					t.Errorf("stored searches grew from %d to %d", stored, len(c.storedSearches))
+				}
+				for i := range got {
+					if got[i].NfInstanceId != first[i].NfInstanceId {
+						t.Errorf("instance %d = %s, want stored order %s", i, got[i].NfInstanceId, first[i].NfInstanceId)
+					}
+				}
+			}
+		})
+	}
+}
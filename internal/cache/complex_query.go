@@ -0,0 +1,236 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// ComplexQuery is the parsed "complex-query" discovery parameter, in CNF or
+// DNF as per TS 29.510 clause 6.2.3.2.3.1.
+type ComplexQuery struct {
+	conjunctive bool
+	units       [][]queryAtom
+}
+
+type queryAtom struct {
+	attr     string
+	values   []string
+	negative bool
+}
+
+// The generated openapi models decode atom values as objects only, while the
+// specification allows any JSON value, so the query is decoded locally.
+type rawAtom struct {
+	Attr     string          `json:"attr"`
+	Value    json.RawMessage `json:"value"`
+	Negative bool            `json:"negative,omitempty"`
+}
+
+type rawComplexQuery struct {
+	CnfUnits []struct {
+		CnfUnit []rawAtom `json:"cnfUnit"`
+	} `json:"cnfUnits"`
+	DnfUnits []struct {
+		DnfUnit []rawAtom `json:"dnfUnit"`
+	} `json:"dnfUnits"`
+}
+
+// ParseComplexQuery parses the JSON value of the "complex-query" parameter.
+func ParseComplexQuery(raw string) (*ComplexQuery, error) {
+	var rq rawComplexQuery
+	if err := json.Unmarshal([]byte(raw), &rq); err != nil {
+		return nil, fmt.Errorf("unmarshal complex query: %w", err)
+	}
+
+	if (len(rq.CnfUnits) == 0) == (len(rq.DnfUnits) == 0) {
+		return nil, fmt.Errorf("complex query must contain either cnfUnits or dnfUnits")
+	}
+
+	query := &ComplexQuery{conjunctive: len(rq.CnfUnits) > 0}
+
+	var rawUnits [][]rawAtom
+	for _, unit := range rq.CnfUnits {
+		rawUnits = append(rawUnits, unit.CnfUnit)
+	}
+	for _, unit := range rq.DnfUnits {
+		rawUnits = append(rawUnits, unit.DnfUnit)
+	}
+
+	for _, rawUnit := range rawUnits {
+		if len(rawUnit) == 0 {
+			return nil, fmt.Errorf("complex query contains an empty unit")
+		}
+
+		unit := make([]queryAtom, 0, len(rawUnit))
+		for _, ra := range rawUnit {
+			atom, err := parseAtom(ra)
+			if err != nil {
+				return nil, err
+			}
+			unit = append(unit, atom)
+		}
+		query.units = append(query.units, unit)
+	}
+
+	return query, nil
+}
+
+func parseAtom(ra rawAtom) (queryAtom, error) {
+	if ra.Attr == "" {
+		return queryAtom{}, fmt.Errorf("complex query atom without attr")
+	}
+
+	atom := queryAtom{attr: ra.Attr, negative: ra.Negative}
+
+	var list []json.RawMessage
+	if err := json.Unmarshal(ra.Value, &list); err != nil {
+		list = []json.RawMessage{ra.Value}
+	}
+
+	for _, item := range list {
+		value, err := atomValueString(item)
+		if err != nil {
+			return queryAtom{}, fmt.Errorf("complex query atom %s: %w", ra.Attr, err)
+		}
+		atom.values = append(atom.values, value)
+	}
+
+	if len(atom.values) == 0 {
+		return queryAtom{}, fmt.Errorf("complex query atom %s without value", ra.Attr)
+	}
+
+	return atom, nil
+}
+
+// atomValueString converts an atom value into its query string form.
+func atomValueString(raw json.RawMessage) (string, error) {
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str, nil
+	}
+
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil || v == nil {
+		return "", fmt.Errorf("invalid value")
+	}
+
+	compact, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(compact), nil
+}
+
+// evaluate reports whether the expression holds, using match to evaluate
+// each atom as if its attribute had been sent as a plain query parameter.
+// known is false as soon as an atom, negative or not, cannot be decided.
+func (q *ComplexQuery) evaluate(match func(attr string, values []string) paramMatch) (matched bool, known bool) {
+	evalAtom := func(atom queryAtom) (bool, bool) {
+		result := match(atom.attr, atom.values)
+		if result == paramUnknown {
+			return false, false
+		}
+		return (result == paramMatched) != atom.negative, true
+	}
+
+	for _, unit := range q.units {
+		if q.conjunctive {
+			// cnfUnit: OR of atoms, units are ANDed
+			satisfied := false
+			for _, atom := range unit {
+				holds, known := evalAtom(atom)
+				if !known {
+					return false, false
+				}
+				if holds {
+					satisfied = true
+					break
+				}
+			}
+			if !satisfied {
+				return false, true
+			}
+		} else {
+			// dnfUnit: AND of atoms, units are ORed
+			satisfied := true
+			for _, atom := range unit {
+				holds, known := evalAtom(atom)
+				if !known {
+					return false, false
+				}
+				if !holds {
+					satisfied = false
+					break
+				}
+			}
+			if satisfied {
+				return true, true
+			}
+		}
+	}
+
+	return q.conjunctive, true
+}
+
+// evaluable reports whether the cache knows every attribute of the
+// expression. Whether they can be decided depends on each profile.
+func (q *ComplexQuery) evaluable() bool {
+	for _, unit := range q.units {
+		for _, atom := range unit {
+			if !slices.Contains(matchedQueryParams, atom.attr) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Canonical returns an order-independent form of the expression, so
+// equivalent queries share one cache entry.
+func (q *ComplexQuery) Canonical() string {
+	form := "dnf"
+	if q.conjunctive {
+		form = "cnf"
+	}
+
+	units := make([]string, 0, len(q.units))
+	for _, unit := range q.units {
+		atoms := make([]string, 0, len(unit))
+		for _, atom := range unit {
+			values := append([]string(nil), atom.values...)
+			sort.Strings(values)
+
+			encoded, _ := json.Marshal(rawCanonicalAtom{
+				Attr:     atom.attr,
+				Values:   dedupe(values),
+				Negative: atom.negative,
+			})
+			atoms = append(atoms, string(encoded))
+		}
+		sort.Strings(atoms)
+		units = append(units, "["+strings.Join(dedupe(atoms), ",")+"]")
+	}
+	sort.Strings(units)
+
+	return form + ":[" + strings.Join(dedupe(units), ",") + "]"
+}
+
+type rawCanonicalAtom struct {
+	Attr     string   `json:"attr"`
+	Values   []string `json:"values"`
+	Negative bool     `json:"negative,omitempty"`
+}
+
+// dedupe removes adjacent duplicates from a sorted slice.
+func dedupe(sorted []string) []string {
+	out := sorted[:0]
+	for _, s := range sorted {
+		if len(out) == 0 || s != out[len(out)-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,271 @@
+package cache
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func TestParseComplexQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"cnf", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"ims"}]}]}`, false},
+		{"dnf with list and object values", `{"dnfUnits":[{"dnfUnit":[{"attr":"snssais","value":[{"sst":1}]},{"attr":"dnn","value":["a","b"],"negative":true}]}]}`, false},
+		{"invalid json", `{"cnfUnits":`, true},
+		{"neither form", `{}`, true},
+		{"both forms", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"a"}]}],"dnfUnits":[{"dnfUnit":[{"attr":"dnn","value":"a"}]}]}`, true},
+		{"empty unit", `{"cnfUnits":[{"cnfUnit":[]}]}`, true},
+		{"atom without attr", `{"cnfUnits":[{"cnfUnit":[{"value":"a"}]}]}`, true},
+		{"atom without value", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":[]}]}]}`, true},
+		{"null value", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":null}]}]}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseComplexQuery(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComplexQueryEvaluate(t *testing.T) {
+	// The atoms x and y hold, z does not and u cannot be decided
+	facts := map[string]paramMatch{"x": paramMatched, "y": paramMatched, "z": paramMismatch, "u": paramUnknown}
+	match := func(attr string, values []string) paramMatch { return facts[attr] }
+
+	tests := []struct {
+		name      string
+		raw       string
+		want      bool
+		wantKnown bool
+	}{
+		{"cnf all units hold", `{"cnfUnits":[{"cnfUnit":[{"attr":"x","value":"1"}]},{"cnfUnit":[{"attr":"z","value":"1"},{"attr":"y","value":"1"}]}]}`, true, true},
+		{"cnf one unit fails", `{"cnfUnits":[{"cnfUnit":[{"attr":"x","value":"1"}]},{"cnfUnit":[{"attr":"z","value":"1"}]}]}`, false, true},
+		{"dnf one unit holds", `{"dnfUnits":[{"dnfUnit":[{"attr":"x","value":"1"},{"attr":"z","value":"1"}]},{"dnfUnit":[{"attr":"y","value":"1"}]}]}`, true, true},
+		{"dnf no unit holds", `{"dnfUnits":[{"dnfUnit":[{"attr":"x","value":"1"},{"attr":"z","value":"1"}]}]}`, false, true},
+		{"negative atom", `{"cnfUnits":[{"cnfUnit":[{"attr":"z","value":"1","negative":true}]}]}`, true, true},
+		{"negated holding atom", `{"dnfUnits":[{"dnfUnit":[{"attr":"x","value":"1","negative":true}]}]}`, false, true},
+		{"unknown atom", `{"cnfUnits":[{"cnfUnit":[{"attr":"u","value":"1"}]}]}`, false, false},
+		{"negated unknown atom", `{"dnfUnits":[{"dnfUnit":[{"attr":"u","value":"1","negative":true}]}]}`, false, false},
+		{"unknown atom after a failing unit", `{"dnfUnits":[{"dnfUnit":[{"attr":"z","value":"1"}]},{"dnfUnit":[{"attr":"u","value":"1"}]}]}`, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseComplexQuery(tt.raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, known := query.evaluate(match)
+			if got != tt.want || known != tt.wantKnown {
+				t.Errorf("evaluate = %v, %v, want %v, %v", got, known, tt.want, tt.wantKnown)
+			}
+		})
+	}
+}
+
+func TestComplexQueryCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{
+			"unit, atom and value order",
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":["b","a"]},{"attr":"snssais","value":{"sst":1}}]},{"cnfUnit":[{"attr":"dnn","value":"c"}]}]}`,
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"c"}]},{"cnfUnit":[{"attr":"snssais","value":{"sst":1}},{"attr":"dnn","value":["a","b","a"]}]}]}`,
+			true,
+		},
+		{
+			"value with separator vs list",
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"a,b"}]}]}`,
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":["a","b"]}]}]}`,
+			false,
+		},
+		{
+			"atom separators in values",
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"a|dnn=b"}]}]}`,
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"a"},{"attr":"dnn","value":"b"}]}]}`,
+			false,
+		},
+		{
+			"negative",
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"a"}]}]}`,
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"a","negative":true}]}]}`,
+			false,
+		},
+		{
+			"cnf vs dnf",
+			`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"a"}]}]}`,
+			`{"dnfUnits":[{"dnfUnit":[{"attr":"dnn","value":"a"}]}]}`,
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseComplexQuery(tt.a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ParseComplexQuery(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if same := a.Canonical() == b.Canonical(); same != tt.same {
+				t.Errorf("%s vs %s: same = %v, want %v", a.Canonical(), b.Canonical(), same, tt.same)
+			}
+		})
+	}
+}
+
+func smfProfile(id string, dnn string) models.NrfNfDiscoveryNfProfile {
+	return models.NrfNfDiscoveryNfProfile{
+		NfInstanceId: id,
+		NfType:       "SMF",
+		SNssais:      []models.ExtSnssai{{Sst: 1, Sd: "010203"}},
+		SmfInfo: &models.SmfInfo{SNssaiSmfInfoList: []models.SnssaiSmfInfoItem{{
+			DnnSmfInfoList: []models.DnnSmfInfoItem{{Dnn: dnn}},
+		}}},
+	}
+}
+
+func upfProfile(id string) models.NrfNfDiscoveryNfProfile {
+	return models.NrfNfDiscoveryNfProfile{
+		NfInstanceId: id,
+		NfType:       "UPF",
+		SNssais:      []models.ExtSnssai{{Sst: 1, Sd: "010203"}},
+		PlmnList:     []models.PlmnId{{Mcc: "208", Mnc: "93"}},
+		UpfInfo: &models.UpfInfo{SNssaiUpfInfoList: []models.SnssaiUpfInfoItem{{
+			SNssai:         &models.ExtSnssai{Sst: 1, Sd: "010203"},
+			DnnUpfInfoList: []models.DnnUpfInfoItem{{Dnn: "internet"}},
+		}}},
+	}
+}
+
+func TestGetComplexQueryResult(t *testing.T) {
+	c := NewNFProfileCache(time.Minute, 0, 0)
+	defer c.Stop()
+
+	c.SetSearchResult(url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}, "",
+		&models.SearchResult{NfInstances: []models.NrfNfDiscoveryNfProfile{
+			smfProfile("smf-internet", "internet"),
+			smfProfile("smf-ims", "ims"),
+		}})
+	c.SetSearchResult(url.Values{"target-nf-type": {"UPF"}, "requester-nf-type": {"SMF"}}, "",
+		&models.SearchResult{NfInstances: []models.NrfNfDiscoveryNfProfile{upfProfile("upf-1")}})
+
+	plmn := `{"cnfUnits":[{"cnfUnit":[{"attr":"target-plmn-list","value":{"mcc":"208","mnc":"93"}}]}]}`
+	tests := []struct {
+		name      string
+		nfType    string
+		query     string
+		wantFound bool
+		wantIDs   []string
+	}{
+		{"positive atom", "SMF", `{"dnfUnits":[{"dnfUnit":[{"attr":"dnn","value":"ims"}]}]}`, true, []string{"smf-ims"}},
+		{"negative atom", "SMF", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"ims","negative":true}]}]}`, true, []string{"smf-internet"}},
+		{"snssai with other sd", "SMF", `{"cnfUnits":[{"cnfUnit":[{"attr":"snssais","value":{"sst":1,"sd":"ffffff"}}]}]}`, true, nil},
+		{"snssai without sd", "SMF", `{"cnfUnits":[{"cnfUnit":[{"attr":"snssais","value":{"sst":1}}]}]}`, true, []string{"smf-internet", "smf-ims"}},
+		{"plmn of profiles without plmnList", "SMF", plmn, false, nil},
+		{"attribute the cache cannot evaluate", "SMF", `{"cnfUnits":[{"cnfUnit":[{"attr":"preferred-locality","value":"x","negative":true}]}]}`, false, nil},
+		{"invalid expression", "SMF", `{"cnfUnits":[]}`, false, nil},
+		{"dnn of a UPF", "UPF", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"internet"}]}]}`, false, nil},
+		{"negative dnn of a UPF", "UPF", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"ims","negative":true}]}]}`, false, nil},
+		{"snssai of a UPF", "UPF", `{"cnfUnits":[{"cnfUnit":[{"attr":"snssais","value":{"sst":1}}]}]}`, true, []string{"upf-1"}},
+		{"plmn of a UPF", "UPF", plmn, true, []string{"upf-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requester := map[string]string{"SMF": "AMF", "UPF": "SMF"}[tt.nfType]
+			query := url.Values{"target-nf-type": {tt.nfType}, "requester-nf-type": {requester}, "complex-query": {tt.query}}
+			result, found := c.GetComplexQueryResult(query)
+			if found != tt.wantFound {
+				t.Fatalf("found = %v, want %v", found, tt.wantFound)
+			}
+			if !found {
+				return
+			}
+			var ids []string
+			for _, profile := range result.NfInstances {
+				ids = append(ids, profile.NfInstanceId)
+			}
+			if len(ids) != len(tt.wantIDs) {
+				t.Fatalf("instances %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantIDs[i] {
+					t.Errorf("instances %v, want %v", ids, tt.wantIDs)
+				}
+			}
+		})
+	}
+
+	// Only the same discovery without the expression may be filtered
+	query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}, "dnn": {"ims"},
+		"complex-query": {`{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"ims"}]}]}`}}
+	if _, found := c.GetComplexQueryResult(query); found {
+		t.Error("answered from the result of a different discovery")
+	}
+}
+
+func TestSearchLeavesUndecidableComplexQueryToNRF(t *testing.T) {
+	c := NewNFProfileCache(time.Minute, 0, 0)
+	defer c.Stop()
+
+	upf := upfProfile("upf-1")
+	c.Put(&upf)
+	noSnssais := upfProfile("upf-2")
+	noSnssais.SNssais = nil
+	c.Put(&noSnssais)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"decidable for every profile", `{"cnfUnits":[{"cnfUnit":[{"attr":"target-nf-instance-id","value":"upf-1"}]}]}`, 1},
+		{"dnn of a UPF", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"ims","negative":true}]}]}`, 0},
+		{"profile without sNssais", `{"cnfUnits":[{"cnfUnit":[{"attr":"snssais","value":{"sst":1}}]}]}`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := c.Search(url.Values{"target-nf-type": {"UPF"}, "complex-query": {tt.query}})
+			if len(results) != tt.want {
+				t.Errorf("Search() returned %d profiles, want %d", len(results), tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateSearchKey(t *testing.T) {
+	key := func(query string) string {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return generateSearchKey(values)
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"limit is ignored", "target-nf-type=SMF&requester-nf-type=AMF&limit=5", "target-nf-type=SMF&requester-nf-type=AMF", true},
+		{"parameter order is ignored", "target-nf-type=SMF&requester-nf-type=AMF&dnn=a&snssais=x", "snssais=x&dnn=a&requester-nf-type=AMF&target-nf-type=SMF", true},
+		{"other dnn", "target-nf-type=SMF&requester-nf-type=AMF&dnn=a", "target-nf-type=SMF&requester-nf-type=AMF&dnn=b", false},
+		{"other requester", "target-nf-type=SMF&requester-nf-type=AMF", "target-nf-type=SMF&requester-nf-type=PCF", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if same := key(tt.a) == key(tt.b); same != tt.same {
+				t.Errorf("%q vs %q: same = %v, want %v", key(tt.a), key(tt.b), same, tt.same)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package cache
+
+import (
+	"slices"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/openapi/models"
+)
+
+// statusDeregistered is used in status-change counts for instances removed
+// through NFDeregister; TS 29.510 has no NFStatus value for it.
+const statusDeregistered = "DEREGISTERED"
+
+// InstanceState holds the attributes of an NF instance from its latest
+// heartbeat or, in fan-out mode, notification.
+type InstanceState struct {
+	NfType       string
+	NfStatus     models.NrfNfManagementNfStatus
+	Deregistered bool
+	Load         int32
+	HasLoad      bool
+	UpdatedAt    time.Time
+}
+
+// ApplyHeartbeat records the attributes of an NFUpdate (heartbeat) patch.
+func (c *NFProfileCache) ApplyHeartbeat(nfInstanceID string, patch []models.PatchItem) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state := c.instanceStateLocked(nfInstanceID)
+	state.Deregistered = false
+	for _, item := range patch {
+		if item.Op != models.PatchOperation_ADD && item.Op != models.PatchOperation_REPLACE {
+			continue
+		}
+
+		switch item.Path {
+		case "/load":
+			if load, ok := item.Value.(float64); ok {
+				state.Load = int32(load)
+				state.HasLoad = true
+			}
+		case "/nfStatus":
+			if status, ok := item.Value.(string); ok {
+				c.setStatusLocked(state, models.NrfNfManagementNfStatus(status))
+			}
+		}
+	}
+	state.UpdatedAt = time.Now()
+}
+
+// SetInstanceStatus records the NFStatus of an instance learned from a full
+// profile, e.g. a registration or an NF_PROFILE_CHANGED notification.
+func (c *NFProfileCache) SetInstanceStatus(
+	nfInstanceID string,
+	nfType models.NrfNfManagementNfType,
+	status models.NrfNfManagementNfStatus,
+) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state := c.instanceStateLocked(nfInstanceID)
+	if nfType != "" {
+		state.NfType = string(nfType)
+	}
+	state.Deregistered = false
+	if status != "" {
+		c.setStatusLocked(state, status)
+	}
+	state.UpdatedAt = time.Now()
+}
+
+// MarkDeregistered hides the instance from cached search results until it
+// registers again.
+func (c *NFProfileCache) MarkDeregistered(nfInstanceID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	state := c.instanceStateLocked(nfInstanceID)
+	if !state.Deregistered {
+		state.Deregistered = true
+		c.countStatusChangeLocked(state.NfType, statusDeregistered)
+	}
+	state.UpdatedAt = time.Now()
+}
+
+// GetInstanceLoad returns the load reported by the latest heartbeat of the
+// NF instance, if any.
+func (c *NFProfileCache) GetInstanceLoad(nfInstanceID string) (int32, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	state, exists := c.instanceStates[nfInstanceID]
+	if !exists || !state.HasLoad {
+		return 0, false
+	}
+	return state.Load, true
+}
+
+// FilterDiscoverable returns a copy of result without suspended,
+// undiscoverable and deregistered instances.
+func (c *NFProfileCache) FilterDiscoverable(result *models.SearchResult) *models.SearchResult {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	instances, filtered := c.discoverableLocked(result.NfInstances)
+	if !filtered {
+		return result
+	}
+
+	out := *result
+	out.NfInstances = instances
+	if out.NumNfInstComplete > 0 {
+		out.NumNfInstComplete -= int32(len(result.NfInstances) - len(out.NfInstances))
+	}
+
+	return &out
+}
+
+// FilterDiscoverableStoredSearch is FilterDiscoverable for a page of a stored
+// search.
+func (c *NFProfileCache) FilterDiscoverableStoredSearch(result *models.StoredSearchResult) *models.StoredSearchResult {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	instances, filtered := c.discoverableLocked(result.NfInstances)
+	if !filtered {
+		return result
+	}
+	return &models.StoredSearchResult{NfInstances: instances}
+}
+
+// discoverableLocked returns a copy of instances without the hidden ones, or
+// false if none is hidden.
+func (c *NFProfileCache) discoverableLocked(
+	instances []models.NrfNfDiscoveryNfProfile,
+) ([]models.NrfNfDiscoveryNfProfile, bool) {
+	hidden := func(nfInstanceID string) bool {
+		state, exists := c.instanceStates[nfInstanceID]
+		if !exists {
+			return false
+		}
+		return state.Deregistered ||
+			state.NfStatus == models.NrfNfManagementNfStatus_SUSPENDED ||
+			state.NfStatus == models.NrfNfManagementNfStatus_UNDISCOVERABLE
+	}
+
+	if !slices.ContainsFunc(instances, func(instance models.NrfNfDiscoveryNfProfile) bool {
+		return hidden(instance.NfInstanceId)
+	}) {
+		return instances, false
+	}
+
+	out := make([]models.NrfNfDiscoveryNfProfile, 0, len(instances)-1)
+	for i := range instances {
+		if !hidden(instances[i].NfInstanceId) {
+			out = append(out, instances[i])
+		}
+	}
+	return out, true
+}
+
+// StatusChangeCounts returns, per NF type, how many times instances changed
+// to each status since startup.
+func (c *NFProfileCache) StatusChangeCounts() map[string]map[string]uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	counts := make(map[string]map[string]uint64, len(c.statusChanges))
+	for nfType, byStatus := range c.statusChanges {
+		counts[nfType] = make(map[string]uint64, len(byStatus))
+		for status, n := range byStatus {
+			counts[nfType][status] = n
+		}
+	}
+	return counts
+}
+
+// observeProfilesLocked seeds the type and status of instances returned by
+// the NRF, which are authoritative at the time they are received.
+func (c *NFProfileCache) observeProfilesLocked(profiles []models.NrfNfDiscoveryNfProfile) {
+	now := time.Now()
+	for i := range profiles {
+		state := c.instanceStateLocked(profiles[i].NfInstanceId)
+		if profiles[i].NfType != "" {
+			state.NfType = string(profiles[i].NfType)
+		}
+		if profiles[i].NfStatus != "" {
+			state.Deregistered = false
+			c.setStatusLocked(state, profiles[i].NfStatus)
+		}
+		state.UpdatedAt = now
+	}
+}
+
+func (c *NFProfileCache) setStatusLocked(state *InstanceState, status models.NrfNfManagementNfStatus) {
+	if state.NfStatus != "" && state.NfStatus != status {
+		logger.CacheLog.Infof("NF status changed: type=%s, %s -> %s", state.NfType, state.NfStatus, status)
+		c.countStatusChangeLocked(state.NfType, string(status))
+	}
+	state.NfStatus = status
+}
+
+// countStatusChangeLocked counts a status change of an instance of nfType.
+// Changes of instances whose type was never learned are not counted.
+func (c *NFProfileCache) countStatusChangeLocked(nfType string, status string) {
+	if nfType == "" {
+		logger.CacheLog.Debugf("NF status change to %s of an instance of unknown type not counted", status)
+		return
+	}
+	if c.statusChanges[nfType] == nil {
+		c.statusChanges[nfType] = make(map[string]uint64)
+	}
+	c.statusChanges[nfType][status]++
+}
+
+func (c *NFProfileCache) instanceStateLocked(nfInstanceID string) *InstanceState {
+	state, exists := c.instanceStates[nfInstanceID]
+	if !exists {
+		state = &InstanceState{}
+		if entry, cached := c.profiles[nfInstanceID]; cached {
+			state.NfType = string(entry.Profile.NfType)
+		}
+		c.instanceStates[nfInstanceID] = state
+	}
+	return state
+}
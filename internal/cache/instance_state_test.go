@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func heartbeat(status models.NrfNfManagementNfStatus) []models.PatchItem {
+	return []models.PatchItem{
+		{Op: models.PatchOperation_REPLACE, Path: "/nfStatus", Value: string(status)},
+		{Op: models.PatchOperation_REPLACE, Path: "/load", Value: float64(10)},
+	}
+}
+
+func TestFilterDiscoverable(t *testing.T) {
+	tests := []struct {
+		name   string
+		events func(c *NFProfileCache)
+		want   []string
+	}{
+		{"unknown instances", func(c *NFProfileCache) {}, []string{"a", "b"}},
+		{"suspended by heartbeat", func(c *NFProfileCache) {
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_SUSPENDED))
+		}, []string{"b"}},
+		{"undiscoverable by notification", func(c *NFProfileCache) {
+			c.SetInstanceStatus("b", "SMF", models.NrfNfManagementNfStatus_UNDISCOVERABLE)
+		}, []string{"a"}},
+		{"deregistered", func(c *NFProfileCache) {
+			c.MarkDeregistered("a")
+		}, []string{"b"}},
+		{"registered heartbeat after deregistration", func(c *NFProfileCache) {
+			c.MarkDeregistered("a")
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_REGISTERED))
+		}, []string{"a", "b"}},
+		{"load-only heartbeat after deregistration", func(c *NFProfileCache) {
+			c.MarkDeregistered("a")
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_REGISTERED)[1:])
+		}, []string{"a", "b"}},
+		{"registration after deregistration", func(c *NFProfileCache) {
+			c.MarkDeregistered("a")
+			c.SetInstanceStatus("a", "SMF", models.NrfNfManagementNfStatus_REGISTERED)
+		}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewNFProfileCache(time.Minute, time.Minute, time.Second)
+			defer c.Stop()
+			tt.events(c)
+
+			result := &models.SearchResult{NfInstances: instances("a", "b"), NumNfInstComplete: 2}
+			filtered := c.FilterDiscoverable(result)
+
+			var got []string
+			for _, profile := range filtered.NfInstances {
+				got = append(got, profile.NfInstanceId)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterDiscoverable() = %v, want %v", got, tt.want)
+			}
+			if filtered.NumNfInstComplete != int32(len(tt.want)) {
+				t.Errorf("NumNfInstComplete = %d, want %d", filtered.NumNfInstComplete, len(tt.want))
+			}
+			if len(result.NfInstances) != 2 {
+				t.Error("FilterDiscoverable() modified the cached result")
+			}
+		})
+	}
+}
+
+func TestStatusChangeCounts(t *testing.T) {
+	tests := []struct {
+		name   string
+		events func(c *NFProfileCache)
+		want   map[string]map[string]uint64
+	}{
+		{"type from registration", func(c *NFProfileCache) {
+			c.SetInstanceStatus("a", "SMF", models.NrfNfManagementNfStatus_REGISTERED)
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_SUSPENDED))
+			c.MarkDeregistered("a")
+		}, map[string]map[string]uint64{"SMF": {"SUSPENDED": 1, statusDeregistered: 1}}},
+		{"type from cached profile", func(c *NFProfileCache) {
+			c.Put(&models.NrfNfDiscoveryNfProfile{NfInstanceId: "a", NfType: "AMF"})
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_REGISTERED))
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_SUSPENDED))
+		}, map[string]map[string]uint64{"AMF": {"SUSPENDED": 1}}},
+		{"unknown type is not counted", func(c *NFProfileCache) {
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_REGISTERED))
+			c.ApplyHeartbeat("a", heartbeat(models.NrfNfManagementNfStatus_SUSPENDED))
+			c.MarkDeregistered("b")
+		}, map[string]map[string]uint64{}},
+		{"full profile without status", func(c *NFProfileCache) {
+			c.SetInstanceStatus("a", "SMF", models.NrfNfManagementNfStatus_REGISTERED)
+			c.SetInstanceStatus("a", "SMF", "")
+		}, map[string]map[string]uint64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewNFProfileCache(time.Minute, time.Minute, time.Second)
+			defer c.Stop()
+			tt.events(c)
+
+			if got := c.StatusChangeCounts(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StatusChangeCounts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+// NFListEntry is a cached NFListRetrieval response (the _links list of NF
+// instance URIs).
+type NFListEntry struct {
+	Result    *models.UriList
+	ExpiresAt time.Time
+}
+
+// nfListKey identifies an NFListRetrieval by its query parameters (nf-type,
+// limit, page-number, page-size); Encode sorts them by name.
+func nfListKey(queryParams url.Values) string {
+	return queryParams.Encode()
+}
+
+func (c *NFProfileCache) GetNFList(queryParams url.Values) (*models.UriList, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry, exists := c.nfLists[nfListKey(queryParams)]
+	if !exists || time.Now().After(entry.ExpiresAt) {
+		return nil, false
+	}
+
+	return entry.Result, true
+}
+
+// SetNFList caches an NF list for the TTL of profiles of its nf-type.
+func (c *NFProfileCache) SetNFList(queryParams url.Values, result *models.UriList) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.nfLists[nfListKey(queryParams)] = &NFListEntry{
+		Result:    result,
+		ExpiresAt: time.Now().Add(c.profileTTLLocked(queryParams.Get("nf-type"))),
+	}
+}
+
+// InvalidateNFLists drops all cached NF lists, which are outdated once an NF
+// instance registers or deregisters.
+func (c *NFProfileCache) InvalidateNFLists() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	clear(c.nfLists)
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/free5gc/openapi/models"
+)
+
+// ParsePlmnList decodes a PLMN list query parameter such as target-plmn-list.
+func ParsePlmnList(values []string) ([]models.PlmnId, error) {
+	var plmns []models.PlmnId
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+
+		var list []models.PlmnId
+		if err := json.Unmarshal([]byte(value), &list); err == nil {
+			plmns = append(plmns, list...)
+			continue
+		}
+
+		var plmn models.PlmnId
+		if err := json.Unmarshal([]byte(value), &plmn); err != nil {
+			return nil, fmt.Errorf("invalid PLMN list %q: %w", value, err)
+		}
+		plmns = append(plmns, plmn)
+	}
+	return plmns, nil
+}
+
+// PlmnKey returns the "mcc-mnc" form of a PLMN ID.
+func PlmnKey(plmn models.PlmnId) string {
+	return plmn.Mcc + "-" + plmn.Mnc
+}
+
+// plmnListKey normalizes a PLMN list query parameter for use in cache keys.
+// Unparsable lists are kept verbatim so they never collide with valid ones.
+func plmnListKey(values []string) string {
+	plmns, err := ParsePlmnList(values)
+	if err != nil {
+		return strings.Join(values, ",")
+	}
+
+	keys := make([]string, 0, len(plmns))
+	for _, plmn := range plmns {
+		keys = append(keys, PlmnKey(plmn))
+	}
+	sort.Strings(keys)
+	return strings.Join(dedupe(keys), ",")
+}
@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshot is the on-disk form of the cache, without tokens and states.
+type snapshot struct {
+	SavedAt        time.Time                     `json:"savedAt"`
+	Profiles       []*CacheEntry                 `json:"profiles"`
+	SearchResults  map[string]*SearchResultEntry `json:"searchResults"`
+	StoredSearches map[string]*StoredSearchEntry `json:"storedSearches"`
+	SearchOrigins  map[string]*snapshotOrigin    `json:"searchOrigins"`
+	NFLists        map[string]*NFListEntry       `json:"nfLists"`
+}
+
+// snapshotOrigin is the on-disk form of a searchOrigin.
+type snapshotOrigin struct {
+	NRF       string        `json:"nrf"`
+	TTL       time.Duration `json:"ttl"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+}
+
+// SaveSnapshot writes the cached profiles, discovery results, stored
+// searches with their origin NRFs and NF lists to path. The file is replaced atomically.
+func (c *NFProfileCache) SaveSnapshot(path string) error {
+	c.lock.RLock()
+	snap := snapshot{
+		SavedAt:        time.Now(),
+		Profiles:       make([]*CacheEntry, 0, len(c.profiles)),
+		SearchResults:  c.searchResults,
+		StoredSearches: c.storedSearches,
+		SearchOrigins:  make(map[string]*snapshotOrigin, len(c.searchOrigins)),
+		NFLists:        c.nfLists,
+	}
+	for _, entry := range c.profiles {
+		snap.Profiles = append(snap.Profiles, entry)
+	}
+	for searchID, origin := range c.searchOrigins {
+		snap.SearchOrigins[searchID] = &snapshotOrigin{
+			NRF:       origin.nrf,
+			TTL:       origin.ttl,
+			ExpiresAt: origin.expiresAt,
+		}
+	}
+	data, err := json.Marshal(snap)
+	c.lock.RUnlock()
+	if err != nil {
+		return fmt.Errorf("encode cache snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write cache snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write cache snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write cache snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write cache snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot restores the unexpired entries saved by SaveSnapshot and
+// returns how many were restored.
+func (c *NFProfileCache) LoadSnapshot(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read cache snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return 0, fmt.Errorf("decode cache snapshot: %w", err)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	restored := 0
+	for _, entry := range snap.Profiles {
+		if entry.Profile == nil || now.After(entry.ExpiresAt) {
+			continue
+		}
+		c.profiles[entry.Profile.NfInstanceId] = entry
+		if entry.Profile.NfType != "" {
+			c.addToTypeIndex(string(entry.Profile.NfType), entry.Profile.NfInstanceId)
+		}
+		restored++
+	}
+	for key, entry := range snap.SearchResults {
+		if entry.Result == nil || now.After(entry.ExpiresAt.Add(c.staleTTL)) {
+			continue
+		}
+		c.searchResults[key] = entry
+		restored++
+	}
+	for key, entry := range snap.StoredSearches {
+		if entry.Result == nil || now.After(entry.ExpiresAt) {
+			continue
+		}
+		c.storedSearches[key] = entry
+		restored++
+	}
+	// Without its origin, a stored search missing from the cache would be
+	// retrieved from the home NRF
+	for searchID, origin := range snap.SearchOrigins {
+		if origin == nil || now.After(origin.ExpiresAt) {
+			continue
+		}
+		c.searchOrigins[searchID] = &searchOrigin{
+			nrf:       origin.NRF,
+			ttl:       origin.TTL,
+			expiresAt: origin.ExpiresAt,
+		}
+	}
+	for key, entry := range snap.NFLists {
+		if entry.Result == nil || now.After(entry.ExpiresAt) {
+			continue
+		}
+		c.nfLists[key] = entry
+		restored++
+	}
+
+	return restored, nil
+}
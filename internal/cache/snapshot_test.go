@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+
+	saved := NewNFProfileCache(time.Minute, 0, 0)
+	defer saved.Stop()
+	smf := smfProfile("smf-1", "internet")
+	saved.Put(&smf)
+	query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+	saved.SetSearchResult(query, "001-01", &models.SearchResult{
+		SearchId:    "remote-search",
+		NfInstances: []models.NrfNfDiscoveryNfProfile{smf},
+	})
+	saved.SetStoredSearch("remote-search", false, &models.StoredSearchResult{
+		NfInstances: []models.NrfNfDiscoveryNfProfile{smf},
+	})
+	saved.searchOrigins["expired-search"] = &searchOrigin{nrf: "001-01", expiresAt: time.Now().Add(-time.Second)}
+
+	if err := saved.SaveSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewNFProfileCache(time.Minute, 0, 0)
+	defer restored.Stop()
+	count, err := restored.LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("restored %d entries, want 3", count)
+	}
+
+	tests := []struct {
+		name     string
+		searchID string
+		wantNRF  string
+		wantOK   bool
+	}{
+		{"origin of a stored search", "remote-search", "001-01", true},
+		{"expired origin", "expired-search", "", false},
+		{"unknown search", "other-search", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf, ok := restored.SearchOrigin(tt.searchID)
+			if nrf != tt.wantNRF || ok != tt.wantOK {
+				t.Errorf("SearchOrigin() = %q, %v, want %q, %v", nrf, ok, tt.wantNRF, tt.wantOK)
+			}
+		})
+	}
+
+	if _, found := restored.GetStoredSearch("remote-search", false); !found {
+		t.Error("stored search not restored")
+	}
+	if _, found := restored.GetSearchResult(query); !found {
+		t.Error("search result not restored")
+	}
+	if _, found := restored.Get("smf-1"); !found {
+		t.Error("profile not restored")
+	}
+}
+
+func TestLoadSnapshotWithoutFile(t *testing.T) {
+	c := NewNFProfileCache(time.Minute, 0, 0)
+	defer c.Stop()
+
+	count, err := c.LoadSnapshot(filepath.Join(t.TempDir(), "missing.json"))
+	if count != 0 || err != nil {
+		t.Errorf("LoadSnapshot() = %d, %v, want 0, nil", count, err)
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Names of the cache maps reported by Stats.
+const (
+	mapProfiles       = "profiles"
+	mapSearchResults  = "searchResults"
+	mapStoredSearches = "storedSearches"
+	mapAccessTokens   = "accessTokens"
+	mapNFLists        = "nfLists"
+)
+
+// Stats is a snapshot of the number of entries and of the expired entries
+// removed so far, per cache map.
+type Stats struct {
+	Entries   map[string]int
+	Evictions map[string]uint64
+}
+
+func (c *NFProfileCache) Stats() Stats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	stats := Stats{
+		Entries: map[string]int{
+			mapProfiles:       len(c.profiles),
+			mapSearchResults:  len(c.searchResults),
+			mapStoredSearches: len(c.storedSearches),
+			mapAccessTokens:   len(c.accessTokens),
+			mapNFLists:        len(c.nfLists),
+		},
+		Evictions: make(map[string]uint64, len(c.evictions)),
+	}
+	for name, count := range c.evictions {
+		stats.Evictions[name] = count
+	}
+	return stats
+}
+
+// Ping checks that the cache can be read within timeout, i.e. that its lock
+// is not held indefinitely.
+func (c *NFProfileCache) Ping(timeout time.Duration) error {
+	done := make(chan struct{})
+	go func() {
+		c.lock.RLock()
+		c.lock.RUnlock()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("cache lock not acquired within %s", timeout)
+	}
+}
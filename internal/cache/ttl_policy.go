@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TTLPolicy overrides the default TTL for entries of NfType (any if empty)
+// whose query has every parameter in Query.
+type TTLPolicy struct {
+	NfType string
+	Query  map[string]string
+	TTL    time.Duration
+}
+
+// ValidateTTLPolicies checks policies accepted by SetTTLPolicies.
+func ValidateTTLPolicies(policies []TTLPolicy) error {
+	for i, policy := range policies {
+		if policy.TTL <= 0 {
+			return fmt.Errorf("TTL policy %d: ttl must be positive, got %s", i, policy.TTL)
+		}
+		if policy.NfType == "" && len(policy.Query) == 0 {
+			return fmt.Errorf("TTL policy %d: nfType or query is required", i)
+		}
+	}
+	return nil
+}
+
+// SetTTLPolicies replaces the TTL policies, which are tried in order; the
+// first match decides the TTL of entries cached from then on.
+func (c *NFProfileCache) SetTTLPolicies(policies []TTLPolicy) error {
+	if err := ValidateTTLPolicies(policies); err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ttlPolicies = policies
+	c.cleanupTimer.Reset(cleanupInterval(c.shortestTTLLocked()))
+	return nil
+}
+
+// TTLPolicies returns the TTL policies in the order they are tried.
+func (c *NFProfileCache) TTLPolicies() []TTLPolicy {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return append([]TTLPolicy(nil), c.ttlPolicies...)
+}
+
+// profileTTLLocked is the lifetime of a profile of nfType cached outside of
+// a discovery.
+func (c *NFProfileCache) profileTTLLocked(nfType string) time.Duration {
+	for _, policy := range c.ttlPolicies {
+		if len(policy.Query) == 0 && (policy.NfType == "" || policy.NfType == nfType) {
+			return policy.TTL
+		}
+	}
+	return c.defaultTTL
+}
+
+// searchTTLLocked is the lifetime of the result of a discovery with
+// queryParams.
+func (c *NFProfileCache) searchTTLLocked(queryParams url.Values) time.Duration {
+	targetNfType := queryParams.Get("target-nf-type")
+	for _, policy := range c.ttlPolicies {
+		if policy.NfType != "" && policy.NfType != targetNfType {
+			continue
+		}
+		if matchesPolicyQuery(policy.Query, queryParams) {
+			return policy.TTL
+		}
+	}
+	return c.defaultTTL
+}
+
+func matchesPolicyQuery(query map[string]string, queryParams url.Values) bool {
+	for name, want := range query {
+		found := false
+		for _, value := range queryParams[name] {
+			for _, item := range strings.Split(value, ",") {
+				if strings.TrimSpace(item) == want {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// shortestTTLLocked is the shortest lifetime an entry can get, which sets
+// how often expired entries are removed.
+func (c *NFProfileCache) shortestTTLLocked() time.Duration {
+	shortest := c.defaultTTL
+	for _, policy := range c.ttlPolicies {
+		shortest = min(shortest, policy.TTL)
+	}
+	return shortest
+}
+
+// longestTTLLocked is the longest lifetime an entry can get.
+func (c *NFProfileCache) longestTTLLocked() time.Duration {
+	longest := c.defaultTTL
+	for _, policy := range c.ttlPolicies {
+		longest = max(longest, policy.TTL)
+	}
+	return longest
+}
@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func newPolicyCache(t *testing.T, policies []TTLPolicy) *NFProfileCache {
+	t.Helper()
+	c := NewNFProfileCache(5*time.Minute, time.Minute, time.Second)
+	t.Cleanup(c.Stop)
+	if err := c.SetTTLPolicies(policies); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+var testPolicies = []TTLPolicy{
+	{NfType: "SMF", Query: map[string]string{"dnn": "internet"}, TTL: time.Minute},
+	{NfType: "SMF", TTL: 30 * time.Minute},
+	{Query: map[string]string{"service-names": "nudm-sdm"}, TTL: 2 * time.Minute},
+	{NfType: "NRF", TTL: time.Hour},
+}
+
+func TestSearchTTL(t *testing.T) {
+	c := newPolicyCache(t, testPolicies)
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  time.Duration
+	}{
+		{"type and query", url.Values{"target-nf-type": {"SMF"}, "dnn": {"internet"}}, time.Minute},
+		{"query value in list", url.Values{"target-nf-type": {"SMF"}, "dnn": {"ims, internet"}}, time.Minute},
+		{"type only", url.Values{"target-nf-type": {"SMF"}, "dnn": {"ims"}}, 30 * time.Minute},
+		{"query of any type", url.Values{"target-nf-type": {"UDM"}, "service-names": {"nudm-uecm,nudm-sdm"}}, 2 * time.Minute},
+		{"first match wins", url.Values{"target-nf-type": {"SMF"}, "service-names": {"nudm-sdm"}}, 30 * time.Minute},
+		{"no match", url.Values{"target-nf-type": {"AMF"}}, 5 * time.Minute},
+		{"partial value is no match", url.Values{"target-nf-type": {"UDM"}, "service-names": {"nudm-sdm2"}}, 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.searchTTLLocked(tt.query); got != tt.want {
+				t.Errorf("searchTTLLocked() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileTTL(t *testing.T) {
+	c := newPolicyCache(t, testPolicies)
+
+	tests := []struct {
+		name   string
+		nfType string
+		want   time.Duration
+	}{
+		{"policy without query", "SMF", 30 * time.Minute},
+		{"other type", "NRF", time.Hour},
+		{"query policies do not apply", "UDM", 5 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.profileTTLLocked(tt.nfType); got != tt.want {
+				t.Errorf("profileTTLLocked() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if got := c.shortestTTLLocked(); got != time.Minute {
+		t.Errorf("shortestTTLLocked() = %s, want 1m", got)
+	}
+	if got := c.longestTTLLocked(); got != time.Hour {
+		t.Errorf("longestTTLLocked() = %s, want 1h", got)
+	}
+}
+
+func TestValidateTTLPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies []TTLPolicy
+		wantErr  bool
+	}{
+		{"valid", testPolicies, false},
+		{"none", nil, false},
+		{"zero ttl", []TTLPolicy{{NfType: "SMF"}}, true},
+		{"negative ttl", []TTLPolicy{{NfType: "SMF", TTL: -time.Second}}, true},
+		{"matches everything", []TTLPolicy{{TTL: time.Minute}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateTTLPolicies(tt.policies); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateTTLPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStoredSearchTTL(t *testing.T) {
+	c := newPolicyCache(t, testPolicies)
+
+	c.SetSearchResult(url.Values{"target-nf-type": {"NRF"}}, "", &models.SearchResult{SearchId: "nrf-search"})
+	localID, _, err := c.StoreLocalSearch(url.Values{"target-nf-type": {"SMF"}},
+		make([]models.NrfNfDiscoveryNfProfile, 3), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetStoredSearch("nrf-search", false, &models.StoredSearchResult{})
+	c.SetStoredSearch("unknown-search", false, &models.StoredSearchResult{})
+	c.SetNFList(url.Values{"nf-type": {"SMF"}}, &models.UriList{})
+
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+		want      time.Duration
+	}{
+		{"stored search of NRF discovery", c.storedSearches[storedSearchKey("nrf-search", false)].ExpiresAt, time.Hour},
+		{"stored search of unknown discovery", c.storedSearches[storedSearchKey("unknown-search", false)].ExpiresAt, 5 * time.Minute},
+		{"local search", c.storedSearches[storedSearchKey(localID, true)].ExpiresAt, 30 * time.Minute},
+		{"NF list", c.nfLists[nfListKey(url.Values{"nf-type": {"SMF"}})].ExpiresAt, 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := time.Until(tt.expiresAt); got > tt.want || got < tt.want-time.Minute {
+				t.Errorf("entry expires in %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstanceStateRetention(t *testing.T) {
+	c := newPolicyCache(t, testPolicies)
+
+	c.SetInstanceStatus("nrf-1", "NRF", models.NrfNfManagementNfStatus_SUSPENDED)
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		at   time.Time
+		kept bool
+	}{
+		{"after default ttl", now.Add(10 * time.Minute), true},
+		{"within longest policy ttl and stale ttl", now.Add(time.Hour + 30*time.Second), true},
+		{"after longest policy ttl and stale ttl", now.Add(time.Hour + 2*time.Minute), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.removeExpiredLocked(tt.at)
+			if _, kept := c.instanceStates["nrf-1"]; kept != tt.kept {
+				t.Errorf("state kept = %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel("info")
+
+	tests := []struct {
+		level   string
+		want    string
+		wantErr bool
+	}{
+		{"debug", "debug", false},
+		{"WARN", "warning", false},
+		{"error", "error", false},
+		{"loud", "error", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			err := SetLevel(tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetLevel() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (ValidateLevel(tt.level) != nil) != tt.wantErr {
+				t.Errorf("ValidateLevel() disagrees with SetLevel()")
+			}
+			if got := Level(); got != tt.want {
+				t.Errorf("Level() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetFormat(t *testing.T) {
+	var out bytes.Buffer
+	Log.SetOutput(&out)
+	defer func() {
+		Log.SetOutput(os.Stdout)
+		SetFormat("text")
+	}()
+
+	tests := []struct {
+		format  string
+		check   func(line string) bool
+		wantErr bool
+	}{
+		{format: "json", check: func(line string) bool {
+			var entry map[string]interface{}
+			return json.Unmarshal([]byte(line), &entry) == nil && entry["component"] == "cache"
+		}},
+		{format: "text", check: func(line string) bool {
+			return strings.Contains(line, "component=cache")
+		}},
+		{format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			err := SetFormat(tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			out.Reset()
+			CacheLog.Info("entry")
+			if line := strings.TrimSpace(out.String()); !tt.check(line) {
+				t.Errorf("%s output: %s", tt.format, line)
+			}
+		})
+	}
+}
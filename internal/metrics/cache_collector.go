@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "entries"),
+		"Number of entries per cache map.",
+		[]string{"cache"}, nil)
+
+	cacheEvictionsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "evictions_total"),
+		"Expired entries removed per cache map.",
+		[]string{"cache"}, nil)
+
+	statusChangesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "nf", "status_changes_total"),
+		"NF status changes observed, by NF type and new status.",
+		[]string{"nf_type", "status"}, nil)
+)
+
+// cacheCollector reads the cache statistics at scrape time.
+type cacheCollector struct {
+	cache *cache.NFProfileCache
+}
+
+func NewCacheCollector(c *cache.NFProfileCache) prometheus.Collector {
+	return &cacheCollector{cache: c}
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheEntriesDesc
+	ch <- cacheEvictionsDesc
+	ch <- statusChangesDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cache.Stats()
+	for name, count := range stats.Entries {
+		ch <- prometheus.MustNewConstMetric(cacheEntriesDesc, prometheus.GaugeValue, float64(count), name)
+		ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue,
+			float64(stats.Evictions[name]), name)
+	}
+
+	for nfType, counts := range c.cache.StatusChangeCounts() {
+		for status, count := range counts {
+			ch <- prometheus.MustNewConstMetric(statusChangesDesc, prometheus.CounterValue, float64(count), nfType, status)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package metrics exposes NFPCF's Prometheus metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/free5gc/openapi/models"
+)
+
+const namespace = "nfpcf"
+
+// Results of a cache lookup.
+const (
+	Hit   = "hit"
+	Miss  = "miss"
+	Stale = "stale"
+)
+
+// otherNfType labels target NF types unknown to TS 29.510, which clients could
+// otherwise use to create any number of series.
+const otherNfType = "other"
+
+var nfTypes = map[models.NrfNfManagementNfType]bool{
+	models.NrfNfManagementNfType_NRF:        true,
+	models.NrfNfManagementNfType_UDM:        true,
+	models.NrfNfManagementNfType_AMF:        true,
+	models.NrfNfManagementNfType_SMF:        true,
+	models.NrfNfManagementNfType_AUSF:       true,
+	models.NrfNfManagementNfType_NEF:        true,
+	models.NrfNfManagementNfType_PCF:        true,
+	models.NrfNfManagementNfType_SMSF:       true,
+	models.NrfNfManagementNfType_NSSF:       true,
+	models.NrfNfManagementNfType_UDR:        true,
+	models.NrfNfManagementNfType_LMF:        true,
+	models.NrfNfManagementNfType_GMLC:       true,
+	models.NrfNfManagementNfType__5_G_EIR:   true,
+	models.NrfNfManagementNfType_SEPP:       true,
+	models.NrfNfManagementNfType_UPF:        true,
+	models.NrfNfManagementNfType_N3_IWF:     true,
+	models.NrfNfManagementNfType_AF:         true,
+	models.NrfNfManagementNfType_UDSF:       true,
+	models.NrfNfManagementNfType_BSF:        true,
+	models.NrfNfManagementNfType_CHF:        true,
+	models.NrfNfManagementNfType_NWDAF:      true,
+	models.NrfNfManagementNfType_PCSCF:      true,
+	models.NrfNfManagementNfType_CBCF:       true,
+	models.NrfNfManagementNfType_HSS:        true,
+	models.NrfNfManagementNfType_UCMF:       true,
+	models.NrfNfManagementNfType_SOR_AF:     true,
+	models.NrfNfManagementNfType_SPAF:       true,
+	models.NrfNfManagementNfType_MME:        true,
+	models.NrfNfManagementNfType_SCSAS:      true,
+	models.NrfNfManagementNfType_SCEF:       true,
+	models.NrfNfManagementNfType_SCP:        true,
+	models.NrfNfManagementNfType_NSSAAF:     true,
+	models.NrfNfManagementNfType_ICSCF:      true,
+	models.NrfNfManagementNfType_SCSCF:      true,
+	models.NrfNfManagementNfType_DRA:        true,
+	models.NrfNfManagementNfType_IMS_AS:     true,
+	models.NrfNfManagementNfType_AANF:       true,
+	models.NrfNfManagementNfType__5_G_DDNMF: true,
+	models.NrfNfManagementNfType_NSACF:      true,
+	models.NrfNfManagementNfType_MFAF:       true,
+	models.NrfNfManagementNfType_EASDF:      true,
+	models.NrfNfManagementNfType_DCCF:       true,
+	models.NrfNfManagementNfType_MB_SMF:     true,
+	models.NrfNfManagementNfType_TSCTSF:     true,
+	models.NrfNfManagementNfType_ADRF:       true,
+	models.NrfNfManagementNfType_GBA_BSF:    true,
+	models.NrfNfManagementNfType_CEF:        true,
+	models.NrfNfManagementNfType_MB_UPF:     true,
+	models.NrfNfManagementNfType_NSWOF:      true,
+	models.NrfNfManagementNfType_PKMF:       true,
+	models.NrfNfManagementNfType_MNPF:       true,
+	models.NrfNfManagementNfType_SMS_GMSC:   true,
+	models.NrfNfManagementNfType_SMS_IWMSC:  true,
+	models.NrfNfManagementNfType_MBSF:       true,
+	models.NrfNfManagementNfType_MBSTF:      true,
+	models.NrfNfManagementNfType_PANF:       true,
+}
+
+var registry = prometheus.NewRegistry()
+
+var (
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Discovery cache lookups by target NF type and result (hit, miss, or stale when an expired entry was served).",
+	}, []string{"target_nf_type", "result"})
+
+	sbiInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "sbi",
+		Name:      "requests_in_flight",
+		Help:      "SBI requests currently being served.",
+	})
+
+	nrfRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "nrf",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of NRF operations including retries, by operation and status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"operation", "status"})
+
+	nrfInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "nrf",
+		Name:      "requests_in_flight",
+		Help:      "NRF operations currently in progress, by operation.",
+	}, []string{"operation"})
+
+	circuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "nrf",
+		Name:      "circuit_breaker_state",
+		Help:      "1 for the current circuit breaker state of each NRF endpoint, 0 otherwise.",
+	}, []string{"endpoint", "state"})
+)
+
+var circuitStates = []string{"closed", "open", "half-open"}
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		cacheLookups,
+		sbiInFlight,
+		nrfRequestDuration,
+		nrfInFlight,
+		circuitState,
+	)
+}
+
+// Register adds a collector, e.g. the cache collector, to the registry.
+func Register(collector prometheus.Collector) error {
+	return registry.Register(collector)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+func CacheLookup(targetNfType string, result string) {
+	cacheLookups.WithLabelValues(nfTypeLabel(targetNfType), result).Inc()
+}
+
+func nfTypeLabel(nfType string) string {
+	if nfTypes[models.NrfNfManagementNfType(nfType)] {
+		return nfType
+	}
+	return otherNfType
+}
+
+// InFlight counts the requests served by next.
+func InFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sbiInFlight.Inc()
+		defer sbiInFlight.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NRFRequestStarted counts an NRF operation as in flight and returns the
+// function to call with its status once it completes.
+func NRFRequestStarted(operation string) func(status string) {
+	start := time.Now()
+	nrfInFlight.WithLabelValues(operation).Inc()
+
+	return func(status string) {
+		nrfInFlight.WithLabelValues(operation).Dec()
+		nrfRequestDuration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+func SetCircuitState(endpoint string, state string) {
+	for _, s := range circuitStates {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		circuitState.WithLabelValues(endpoint, s).Set(value)
+	}
+}
+
+// DeleteCircuitState drops the breaker state of an endpoint no longer used.
+func DeleteCircuitState(endpoint string) {
+	circuitState.DeletePartialMatch(prometheus.Labels{"endpoint": endpoint})
+}
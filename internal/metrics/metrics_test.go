@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCacheLookupLabels(t *testing.T) {
+	tests := []struct {
+		name         string
+		targetNfType string
+		wantLabel    string
+	}{
+		{"known type", "SMF", "SMF"},
+		{"type with digit", "5G_EIR", "5G_EIR"},
+		{"unknown type", "NOT-A-TYPE", otherNfType},
+		{"lower case", "smf", otherNfType},
+		{"empty", "", otherNfType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := cacheLookups.WithLabelValues(tt.wantLabel, Hit)
+			before := testutil.ToFloat64(counter)
+			CacheLookup(tt.targetNfType, Hit)
+			if got := testutil.ToFloat64(counter) - before; got != 1 {
+				t.Errorf("lookups labeled %q grew by %v, want 1", tt.wantLabel, got)
+			}
+		})
+	}
+}
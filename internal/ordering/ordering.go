@@ -0,0 +1,182 @@
+package ordering
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/openapi/models"
+)
+
+type Policy string
+
+const (
+	// PolicyNone keeps the order produced by the NRF or the cache.
+	PolicyNone Policy = "none"
+	// PolicyPriority sorts by priority, then by free capacity.
+	PolicyPriority Policy = "priority"
+	// PolicyWeighted sorts by priority and shuffles instances of equal
+	// priority with probabilities proportional to their free capacity.
+	PolicyWeighted Policy = "weighted"
+)
+
+// defaultCapacity is assumed when a profile or service omits its capacity.
+const defaultCapacity = 100
+
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case "", PolicyNone:
+		return PolicyNone, nil
+	case PolicyPriority, PolicyWeighted:
+		return Policy(s), nil
+	}
+	return "", fmt.Errorf("unknown ordering policy %q", s)
+}
+
+// Shaper reorders discovered instances and their services according to the
+// policy of the target NF type.
+type Shaper struct {
+	cache         *cache.NFProfileCache
+	defaultPolicy Policy
+	policies      map[string]Policy
+}
+
+func NewShaper(
+	nfProfileCache *cache.NFProfileCache,
+	defaultPolicy string,
+	nfTypePolicies map[string]string,
+) (*Shaper, error) {
+	def, err := ParsePolicy(defaultPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]Policy, len(nfTypePolicies))
+	for nfType, name := range nfTypePolicies {
+		policy, err := ParsePolicy(name)
+		if err != nil {
+			return nil, fmt.Errorf("nf type %s: %w", nfType, err)
+		}
+		policies[nfType] = policy
+	}
+
+	return &Shaper{
+		cache:         nfProfileCache,
+		defaultPolicy: def,
+		policies:      policies,
+	}, nil
+}
+
+func (s *Shaper) policyFor(targetNfType string) Policy {
+	if policy, exists := s.policies[targetNfType]; exists {
+		return policy
+	}
+	return s.defaultPolicy
+}
+
+// Shape returns the result ordered according to the policy of targetNfType.
+// The given result is never modified since it may be shared with the cache.
+func (s *Shaper) Shape(targetNfType string, result *models.SearchResult) *models.SearchResult {
+	policy := s.policyFor(targetNfType)
+	if policy == PolicyNone || len(result.NfInstances) == 0 {
+		return result
+	}
+
+	shaped := *result
+	shaped.NfInstances = make([]models.NrfNfDiscoveryNfProfile, len(result.NfInstances))
+	copy(shaped.NfInstances, result.NfInstances)
+
+	instances := make([]candidate, len(shaped.NfInstances))
+	for i := range shaped.NfInstances {
+		profile := &shaped.NfInstances[i]
+
+		load := profile.Load
+		if heartbeatLoad, found := s.cache.GetInstanceLoad(profile.NfInstanceId); found {
+			load = heartbeatLoad
+			profile.Load = heartbeatLoad
+		}
+		instances[i] = candidate{index: i, priority: profile.Priority, weight: weight(profile.Capacity, load)}
+
+		if len(profile.NfServices) > 1 {
+			profile.NfServices = shapeServices(policy, profile.NfServices)
+		}
+	}
+
+	order(policy, instances)
+
+	ordered := make([]models.NrfNfDiscoveryNfProfile, len(instances))
+	for i, c := range instances {
+		ordered[i] = shaped.NfInstances[c.index]
+	}
+	shaped.NfInstances = ordered
+
+	return &shaped
+}
+
+func shapeServices(policy Policy, services []models.NrfNfDiscoveryNfService) []models.NrfNfDiscoveryNfService {
+	candidates := make([]candidate, len(services))
+	for i := range services {
+		candidates[i] = candidate{
+			index:    i,
+			priority: services[i].Priority,
+			weight:   weight(services[i].Capacity, services[i].Load),
+		}
+	}
+
+	order(policy, candidates)
+
+	ordered := make([]models.NrfNfDiscoveryNfService, len(candidates))
+	for i, c := range candidates {
+		ordered[i] = services[c.index]
+	}
+	return ordered
+}
+
+type candidate struct {
+	index    int
+	priority int32
+	weight   float64
+	key      float64
+}
+
+// weight is the free capacity of an instance or service: its capacity scaled
+// by the share of load (0-100) still available.
+func weight(capacity int32, load int32) float64 {
+	if capacity <= 0 {
+		capacity = defaultCapacity
+	}
+	if load < 0 {
+		load = 0
+	}
+	if load > 100 {
+		load = 100
+	}
+
+	w := float64(capacity) * float64(100-load) / 100
+	// Fully loaded candidates stay selectable, just last
+	return math.Max(w, 0.01)
+}
+
+// order sorts candidates by ascending priority, then by weight.
+func order(policy Policy, candidates []candidate) {
+	if policy == PolicyWeighted {
+		// Efraimidis-Spirakis: sorting by u^(1/w) yields a permutation where
+		// each candidate comes first with probability w / sum(w).
+		for i := range candidates {
+			candidates[i].key = math.Pow(rand.Float64(), 1/candidates[i].weight)
+		}
+	} else {
+		for i := range candidates {
+			candidates[i].key = candidates[i].weight
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].key > candidates[j].key
+	})
+}
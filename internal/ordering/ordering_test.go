@@ -0,0 +1,172 @@
+package ordering
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/openapi/models"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Policy
+		wantErr bool
+	}{
+		{"", PolicyNone, false},
+		{"none", PolicyNone, false},
+		{"priority", PolicyPriority, false},
+		{"weighted", PolicyWeighted, false},
+		{"random", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicy(tt.name)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ParsePolicy() = %q, %v, want %q, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWeight(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int32
+		load     int32
+		want     float64
+	}{
+		{"idle", 200, 0, 200},
+		{"half loaded", 200, 50, 100},
+		{"default capacity", 0, 50, 50},
+		{"fully loaded stays selectable", 100, 100, 0.01},
+		{"load above 100", 100, 150, 0.01},
+		{"negative load", 100, -10, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := weight(tt.capacity, tt.load); got != tt.want {
+				t.Errorf("weight() = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
+
+func profile(id string, priority, capacity, load int32) models.NrfNfDiscoveryNfProfile {
+	return models.NrfNfDiscoveryNfProfile{
+		NfInstanceId: id,
+		NfType:       models.NrfNfManagementNfType_SMF,
+		Priority:     priority,
+		Capacity:     capacity,
+		Load:         load,
+	}
+}
+
+func TestShape(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     string
+		instances  []models.NrfNfDiscoveryNfProfile
+		heartbeats map[string]float64
+		want       []string
+	}{
+		{
+			name:      "none keeps order",
+			policy:    "none",
+			instances: []models.NrfNfDiscoveryNfProfile{profile("a", 2, 100, 0), profile("b", 1, 100, 0)},
+			want:      []string{"a", "b"},
+		},
+		{
+			name:      "priority first",
+			policy:    "priority",
+			instances: []models.NrfNfDiscoveryNfProfile{profile("a", 2, 100, 0), profile("b", 1, 100, 0)},
+			want:      []string{"b", "a"},
+		},
+		{
+			name:   "free capacity within a priority",
+			policy: "priority",
+			instances: []models.NrfNfDiscoveryNfProfile{
+				profile("a", 1, 100, 80), profile("b", 1, 100, 10), profile("c", 1, 300, 50),
+			},
+			want: []string{"c", "b", "a"},
+		},
+		{
+			name:       "heartbeat load overrides profile load",
+			policy:     "priority",
+			instances:  []models.NrfNfDiscoveryNfProfile{profile("a", 1, 100, 0), profile("b", 1, 100, 50)},
+			heartbeats: map[string]float64{"a": 90},
+			want:       []string{"b", "a"},
+		},
+		{
+			name:      "weighted keeps priority order",
+			policy:    "weighted",
+			instances: []models.NrfNfDiscoveryNfProfile{profile("a", 3, 100, 0), profile("b", 1, 1, 99), profile("c", 2, 100, 0)},
+			want:      []string{"b", "c", "a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profileCache := cache.NewNFProfileCache(time.Minute, time.Minute, time.Second)
+			defer profileCache.Stop()
+			for id, load := range tt.heartbeats {
+				profileCache.ApplyHeartbeat(id, []models.PatchItem{
+					{Op: models.PatchOperation_REPLACE, Path: "/load", Value: load},
+				})
+			}
+
+			shaper, err := NewShaper(profileCache, "none", map[string]string{"SMF": tt.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := &models.SearchResult{NfInstances: tt.instances}
+			original := append([]models.NrfNfDiscoveryNfProfile(nil), tt.instances...)
+
+			shaped := shaper.Shape("SMF", result)
+
+			var got []string
+			for _, instance := range shaped.NfInstances {
+				got = append(got, instance.NfInstanceId)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Shape() order = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(result.NfInstances, original) {
+				t.Error("Shape() modified the given result")
+			}
+		})
+	}
+}
+
+func TestWeightedOrderFollowsCapacity(t *testing.T) {
+	// b has nine times the free capacity of a, so it comes first about 90%
+	// of the time
+	firsts := map[int]int{}
+	for range 2000 {
+		candidates := []candidate{{index: 0, weight: 10}, {index: 1, weight: 90}}
+		order(PolicyWeighted, candidates)
+		firsts[candidates[0].index]++
+	}
+	if share := float64(firsts[1]) / 2000; share < 0.85 || share > 0.95 {
+		t.Errorf("higher capacity first in %.0f%% of draws, want about 90%%", share*100)
+	}
+}
+
+func TestNewShaperRejectsUnknownPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		defaultPolicy  string
+		nfTypePolicies map[string]string
+	}{
+		{"default", "random", nil},
+		{"per type", "none", map[string]string{"SMF": "random"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewShaper(nil, tt.defaultPolicy, tt.nfTypePolicies); err == nil {
+				t.Error("NewShaper() succeeded")
+			}
+		})
+	}
+}
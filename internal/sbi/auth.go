@@ -0,0 +1,183 @@
+package sbi
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessTokenClaims are the claims of an NRF-issued access token
+// (AccessTokenClaims, TS 29.510).
+type accessTokenClaims struct {
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// tokenValidator verifies JWT access tokens issued by the NRF.
+type tokenValidator struct {
+	keys      jwt.VerificationKeySet
+	issuer    string
+	audiences []string
+	parser    *jwt.Parser
+}
+
+func newTokenValidator(config *factory.InboundOAuth2) (*tokenValidator, error) {
+	v := &tokenValidator{
+		issuer:    config.Issuer,
+		audiences: config.Audiences,
+	}
+	if len(v.audiences) == 0 {
+		// NFPCF serves the NRF's services, so tokens are issued for the NRF
+		v.audiences = []string{string(models.NrfNfManagementNfType_NRF)}
+	}
+
+	for _, path := range config.Keys {
+		keys, err := loadVerificationKeys(path)
+		if err != nil {
+			return nil, err
+		}
+		v.keys.Keys = append(v.keys.Keys, keys...)
+	}
+	if len(v.keys.Keys) == 0 {
+		return nil, errors.New("server.oauth2: no NRF public key or certificate configured")
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if v.issuer != "" {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+	v.parser = jwt.NewParser(options...)
+
+	return v, nil
+}
+
+// loadVerificationKeys reads the public keys from a PEM file holding public
+// keys and/or certificates.
+func loadVerificationKeys(path string) ([]jwt.VerificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read NRF key: %w", err)
+	}
+
+	var keys []jwt.VerificationKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse NRF certificate in %s: %w", path, err)
+			}
+			keys = append(keys, cert.PublicKey)
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse NRF public key in %s: %w", path, err)
+			}
+			keys = append(keys, key)
+		case "RSA PUBLIC KEY":
+			key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parse NRF public key in %s: %w", path, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public key or certificate found in %s", path)
+	}
+	return keys, nil
+}
+
+// validate verifies the bearer token of the request and returns its claims.
+// The error is meant for the error_description of WWW-Authenticate.
+func (v *tokenValidator) validate(r *http.Request) (*accessTokenClaims, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, errors.New("missing bearer token")
+	}
+
+	claims := &accessTokenClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return v.keys, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token has no sub claim")
+	}
+
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(v.audiences, aud)
+	}) {
+		return nil, errors.New("token audience not accepted")
+	}
+
+	return claims, nil
+}
+
+// authorize requires an access token with the service in its scope and,
+// for writes to an NF instance, that instance as subject.
+func (s *Server) authorize(service string, next http.HandlerFunc) http.HandlerFunc {
+	if s.tokenValidator == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := s.tokenValidator.validate(r)
+		if err != nil {
+			sendAuthError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+			return
+		}
+
+		if !slices.Contains(strings.Fields(claims.Scope), service) {
+			sendAuthError(w, http.StatusForbidden, "insufficient_scope", "token scope does not include "+service)
+			return
+		}
+
+		if service == "nnrf-nfm" && r.Method != http.MethodGet && r.Method != http.MethodOptions {
+			pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+			if len(pathParts) >= 4 && pathParts[2] == "nf-instances" && pathParts[3] != claims.Subject {
+				sendAuthError(w, http.StatusForbidden, "insufficient_scope", "token subject does not match the NF instance")
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+func sendAuthError(w http.ResponseWriter, status int, oauthError string, description string) {
+	w.Header().Set("WWW-Authenticate",
+		fmt.Sprintf(`Bearer error="%s", error_description="%s"`, oauthError, strings.ReplaceAll(description, `"`, "'")))
+
+	cause := "UNAUTHORIZED"
+	if status == http.StatusForbidden {
+		cause = "INSUFFICIENT_SCOPE"
+	}
+	sendJSON(w, status, models.ProblemDetails{
+		Status: int32(status),
+		Cause:  cause,
+		Detail: description,
+	})
+}
@@ -0,0 +1,168 @@
+package sbi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+func newSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestValidator returns a validator trusting the public key of key.
+func newTestValidator(t *testing.T, key *ecdsa.PrivateKey, config factory.InboundOAuth2) *tokenValidator {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "nrf.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Enable = true
+	config.Keys = []string{path}
+	v, err := newTokenValidator(&config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func validClaims() *accessTokenClaims {
+	return &accessTokenClaims{
+		Scope: "nnrf-disc nnrf-nfm",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "nrf-1",
+			Subject:   "amf-1",
+			Audience:  jwt.ClaimStrings{"NRF"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+}
+
+func bearerRequest(t *testing.T, method, target string, key *ecdsa.PrivateKey, claims *accessTokenClaims) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(method, target, nil)
+	if claims != nil {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestTokenValidator(t *testing.T) {
+	key := newSigningKey(t)
+	otherKey := newSigningKey(t)
+
+	tests := []struct {
+		name    string
+		config  factory.InboundOAuth2
+		signer  *ecdsa.PrivateKey
+		claims  func(*accessTokenClaims)
+		wantErr bool
+	}{
+		{name: "valid", config: factory.InboundOAuth2{Issuer: "nrf-1"}, signer: key},
+		{name: "bad signature", signer: otherKey, wantErr: true},
+		{name: "expired", signer: key, claims: func(c *accessTokenClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}, wantErr: true},
+		{name: "no expiry", signer: key, claims: func(c *accessTokenClaims) { c.ExpiresAt = nil }, wantErr: true},
+		{name: "wrong issuer", config: factory.InboundOAuth2{Issuer: "nrf-2"}, signer: key, wantErr: true},
+		{name: "wrong default audience", signer: key, claims: func(c *accessTokenClaims) {
+			c.Audience = jwt.ClaimStrings{"AMF"}
+		}, wantErr: true},
+		{name: "no audience", signer: key, claims: func(c *accessTokenClaims) { c.Audience = nil }, wantErr: true},
+		{name: "configured audience", config: factory.InboundOAuth2{Audiences: []string{"nfpcf-1"}}, signer: key, claims: func(c *accessTokenClaims) {
+			c.Audience = jwt.ClaimStrings{"SMF", "nfpcf-1"}
+		}},
+		{name: "audience not configured", config: factory.InboundOAuth2{Audiences: []string{"nfpcf-1"}}, signer: key, wantErr: true},
+		{name: "no subject", signer: key, claims: func(c *accessTokenClaims) { c.Subject = "" }, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestValidator(t, key, tt.config)
+			claims := validClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+
+			_, err := v.validate(bearerRequest(t, http.MethodGet, "/", tt.signer, claims))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	key := newSigningKey(t)
+	s := &Server{tokenValidator: newTestValidator(t, key, factory.InboundOAuth2{})}
+
+	tests := []struct {
+		name       string
+		service    string
+		method     string
+		target     string
+		claims     func(*accessTokenClaims)
+		noToken    bool
+		wantStatus int
+	}{
+		{name: "discovery", service: "nnrf-disc", method: http.MethodGet, target: "/nnrf-disc/v1/nf-instances", wantStatus: http.StatusOK},
+		{name: "missing token", service: "nnrf-disc", method: http.MethodGet, target: "/nnrf-disc/v1/nf-instances", noToken: true, wantStatus: http.StatusUnauthorized},
+		{name: "wrong scope", service: "nnrf-disc", method: http.MethodGet, target: "/nnrf-disc/v1/nf-instances", claims: func(c *accessTokenClaims) {
+			c.Scope = "nnrf-nfm"
+		}, wantStatus: http.StatusForbidden},
+		{name: "scope prefix is no match", service: "nnrf-disc", method: http.MethodGet, target: "/nnrf-disc/v1/nf-instances", claims: func(c *accessTokenClaims) {
+			c.Scope = "nnrf-disc-extra"
+		}, wantStatus: http.StatusForbidden},
+		{name: "own instance", service: "nnrf-nfm", method: http.MethodPut, target: "/nnrf-nfm/v1/nf-instances/amf-1", wantStatus: http.StatusOK},
+		{name: "other instance", service: "nnrf-nfm", method: http.MethodPut, target: "/nnrf-nfm/v1/nf-instances/amf-2", wantStatus: http.StatusForbidden},
+		{name: "read other instance", service: "nnrf-nfm", method: http.MethodGet, target: "/nnrf-nfm/v1/nf-instances/amf-2", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			if tt.noToken {
+				claims = nil
+			}
+
+			handler := s.authorize(tt.service, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			rec := httptest.NewRecorder()
+			handler(rec, bearerRequest(t, tt.method, tt.target, key, claims))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package consumer
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/metrics"
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+// ErrNRFUnavailable is returned without contacting the NRF when the circuit
+// breakers of all its endpoints are open.
+var ErrNRFUnavailable = errors.New("NRF unavailable: circuit breaker open")
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// circuitBreaker guards one NRF endpoint, see factory.CircuitBreaker.
+type circuitBreaker struct {
+	url         string
+	config      *factory.CircuitBreaker
+	state       CircuitState
+	openedAt    time.Time
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+	halfOpen    int
+	lock        sync.Mutex
+}
+
+func newCircuitBreaker(url string, config *factory.CircuitBreaker) *circuitBreaker {
+	metrics.SetCircuitState(url, string(CircuitClosed))
+
+	return &circuitBreaker{
+		url:         url,
+		config:      config,
+		state:       CircuitClosed,
+		windowStart: time.Now(),
+	}
+}
+
+// allow reports whether a call may be sent to the endpoint now. Every
+// allowed call must be followed by record or release.
+func (b *circuitBreaker) allow() bool {
+	if !b.config.Enable {
+		return true
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if time.Since(b.openedAt) < b.config.OpenTimeout {
+			return false
+		}
+		b.transitionLocked(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if b.halfOpen >= b.config.HalfOpenMaxRequests {
+			return false
+		}
+		b.halfOpen++
+	}
+	return true
+}
+
+// record reports the outcome of an allowed call.
+func (b *circuitBreaker) record(success bool) {
+	if !b.config.Enable {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	if now.Sub(b.windowStart) > b.config.Window {
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+	b.requests++
+
+	if success {
+		b.consecutive = 0
+		if b.state == CircuitHalfOpen {
+			b.transitionLocked(CircuitClosed)
+		}
+		return
+	}
+
+	b.failures++
+	b.consecutive++
+
+	switch b.state {
+	case CircuitHalfOpen:
+		b.transitionLocked(CircuitOpen)
+	case CircuitClosed:
+		if b.consecutive >= b.config.ConsecutiveFailures ||
+			(b.requests >= b.config.MinRequests &&
+				float64(b.failures)/float64(b.requests) >= b.config.ErrorRateThreshold) {
+			b.transitionLocked(CircuitOpen)
+		}
+	}
+}
+
+// release ends an allowed call without an outcome, e.g. one cancelled by the
+// caller, which says nothing about the endpoint.
+func (b *circuitBreaker) release() {
+	if !b.config.Enable {
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.state == CircuitHalfOpen && b.halfOpen > 0 {
+		b.halfOpen--
+	}
+}
+
+// isServerFailure reports whether an NRF response indicates that the NRF
+// itself is degraded, as opposed to a rejected request.
+func isServerFailure(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (b *circuitBreaker) currentState() CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) transitionLocked(state CircuitState) {
+	logger.ConsumerLog.Warnf("NRF endpoint %s circuit breaker: %s -> %s", b.url, b.state, state)
+
+	b.state = state
+	b.halfOpen = 0
+	metrics.SetCircuitState(b.url, string(state))
+	switch state {
+	case CircuitOpen:
+		b.openedAt = time.Now()
+	case CircuitClosed:
+		b.consecutive = 0
+		b.windowStart = time.Now()
+		b.requests = 0
+		b.failures = 0
+	}
+}
@@ -0,0 +1,124 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+func testBreakerConfig() *factory.CircuitBreaker {
+	return &factory.CircuitBreaker{
+		Enable:              true,
+		ConsecutiveFailures: 3,
+		ErrorRateThreshold:  0.5,
+		MinRequests:         4,
+		Window:              time.Minute,
+		OpenTimeout:         10 * time.Millisecond,
+		HalfOpenMaxRequests: 1,
+	}
+}
+
+// breakerStep is one call on a circuit breaker: "ok" and "fail" are an
+// allowed call with that outcome, "cancel" an allowed call released without
+// one, "allow" an allowed call still in progress, "deny" a call that must
+// not be allowed, and "wait" lets OpenTimeout pass.
+type breakerStep string
+
+func TestCircuitBreaker(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []breakerStep
+		want  CircuitState
+	}{
+		{"stays closed on success", []breakerStep{"ok", "ok", "ok"}, CircuitClosed},
+		{"opens on consecutive failures", []breakerStep{"fail", "fail", "fail", "deny"}, CircuitOpen},
+		{"success resets consecutive failures", []breakerStep{"ok", "ok", "ok", "fail", "fail", "ok", "fail"}, CircuitClosed},
+		{"opens on error rate", []breakerStep{"ok", "fail", "ok", "fail", "deny"}, CircuitOpen},
+		{"error rate needs min requests", []breakerStep{"ok", "fail", "fail"}, CircuitClosed},
+		{"half-open after open timeout", []breakerStep{"fail", "fail", "fail", "wait", "cancel"}, CircuitHalfOpen},
+		{"half-open success closes", []breakerStep{"fail", "fail", "fail", "wait", "ok", "ok"}, CircuitClosed},
+		{"half-open failure reopens", []breakerStep{"fail", "fail", "fail", "wait", "fail", "deny"}, CircuitOpen},
+		{"half-open limits trial calls", []breakerStep{"fail", "fail", "fail", "wait", "allow", "deny"}, CircuitHalfOpen},
+		{"release frees the trial call", []breakerStep{"fail", "fail", "fail", "wait", "cancel", "cancel", "ok"}, CircuitClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker("http://nrf.example", testBreakerConfig())
+			for i, step := range tt.steps {
+				switch step {
+				case "wait":
+					time.Sleep(2 * b.config.OpenTimeout)
+					continue
+				case "deny":
+					if b.allow() {
+						t.Fatalf("step %d: call allowed in state %s", i, b.currentState())
+					}
+					continue
+				}
+
+				if !b.allow() {
+					t.Fatalf("step %d: call denied in state %s", i, b.currentState())
+				}
+				switch step {
+				case "ok":
+					b.record(true)
+				case "fail":
+					b.record(false)
+				case "cancel":
+					b.release()
+				}
+			}
+			if got := b.currentState(); got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := newCircuitBreaker("http://nrf.example", &factory.CircuitBreaker{ConsecutiveFailures: 1})
+	for range 3 {
+		if !b.allow() {
+			t.Fatal("disabled breaker denied a call")
+		}
+		b.record(false)
+	}
+	if got := b.currentState(); got != CircuitClosed {
+		t.Errorf("state = %s, want %s", got, CircuitClosed)
+	}
+}
+
+func TestCancelledRequestKeepsBreakerHalfOpen(t *testing.T) {
+	nrf, _ := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	nrfConfig := testNRFConfig(nrf.URL)
+	nrfConfig.Retry.MaxAttempts = 1
+	nrfConfig.CircuitBreaker = testBreakerConfig()
+	client := newTestClient(t, nrfConfig)
+
+	b := client.endpoints.candidates()[0].breaker
+	for range nrfConfig.CircuitBreaker.ConsecutiveFailures {
+		b.allow()
+		b.record(false)
+	}
+	time.Sleep(2 * nrfConfig.CircuitBreaker.OpenTimeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := client.DiscoverNF(ctx, url.Values{"target-nf-type": {"SMF"}}); err == nil {
+		t.Fatal("DiscoverNF() succeeded after the caller gave up")
+	}
+
+	if got := b.currentState(); got != CircuitHalfOpen {
+		t.Errorf("state = %s, want %s", got, CircuitHalfOpen)
+	}
+	if !b.allow() {
+		t.Error("cancelled request kept the half-open trial call")
+	}
+}
@@ -0,0 +1,184 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/metrics"
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+const (
+	PolicyPrimarySecondary = "primary-secondary"
+	PolicyRoundRobin       = "round-robin"
+)
+
+type endpoint struct {
+	url          string
+	healthy      bool
+	ejectedUntil time.Time
+	breaker      *circuitBreaker
+}
+
+// EndpointStatus is a snapshot of the state of one backend NRF endpoint.
+type EndpointStatus struct {
+	URL          string       `json:"url"`
+	Healthy      bool         `json:"healthy"`
+	EjectedUntil time.Time    `json:"ejectedUntil,omitempty"`
+	Circuit      CircuitState `json:"circuit"`
+}
+
+// endpointPool orders the NRF endpoints for each call, putting ejected
+// endpoints last.
+type endpointPool struct {
+	endpoints     []*endpoint
+	policy        string
+	next          int
+	ejectionTime  time.Duration
+	breakerConfig *factory.CircuitBreaker
+	lock          sync.Mutex
+}
+
+func newEndpointPool(
+	urls []string,
+	policy string,
+	ejectionTime time.Duration,
+	breakerConfig *factory.CircuitBreaker,
+) *endpointPool {
+	pool := &endpointPool{
+		policy:        policy,
+		ejectionTime:  ejectionTime,
+		breakerConfig: breakerConfig,
+	}
+	pool.setURLs(urls)
+	return pool
+}
+
+// setURLs replaces the endpoints by urls, in order. Endpoints kept keep
+// their health and circuit breaker state.
+func (p *endpointPool) setURLs(urls []string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	current := make(map[string]*endpoint, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		current[ep.url] = ep
+	}
+
+	endpoints := make([]*endpoint, 0, len(urls))
+	for _, u := range urls {
+		if ep, exists := current[u]; exists {
+			endpoints = append(endpoints, ep)
+			delete(current, u)
+			continue
+		}
+		endpoints = append(endpoints, &endpoint{
+			url:     u,
+			healthy: true,
+			breaker: newCircuitBreaker(u, p.breakerConfig),
+		})
+	}
+	for u := range current {
+		metrics.DeleteCircuitState(u)
+	}
+
+	p.endpoints = endpoints
+	p.next = 0
+}
+
+// candidates returns the endpoints to try for one call, in order.
+func (p *endpointPool) candidates() []*endpoint {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	n := len(p.endpoints)
+	start := 0
+	if p.policy == PolicyRoundRobin && n > 0 {
+		start = p.next % n
+		p.next = (p.next + 1) % n
+	}
+
+	now := time.Now()
+	available := make([]*endpoint, 0, n)
+	var ejected []*endpoint
+	for i := 0; i < n; i++ {
+		ep := p.endpoints[(start+i)%n]
+		if now.Before(ep.ejectedUntil) {
+			ejected = append(ejected, ep)
+		} else {
+			available = append(available, ep)
+		}
+	}
+
+	return append(available, ejected...)
+}
+
+func (p *endpointPool) markFailure(ep *endpoint) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if ep.healthy {
+		logger.ConsumerLog.Warnf("NRF endpoint %s ejected for %s", ep.url, p.ejectionTime)
+	}
+	ep.healthy = false
+	ep.ejectedUntil = time.Now().Add(p.ejectionTime)
+}
+
+func (p *endpointPool) markSuccess(ep *endpoint) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if !ep.healthy {
+		logger.ConsumerLog.Infof("NRF endpoint %s is healthy again", ep.url)
+	}
+	ep.healthy = true
+	ep.ejectedUntil = time.Time{}
+}
+
+func (p *endpointPool) status() []EndpointStatus {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	statuses := make([]EndpointStatus, 0, len(p.endpoints))
+	for _, ep := range p.endpoints {
+		statuses = append(statuses, EndpointStatus{
+			URL:          ep.url,
+			Healthy:      ep.healthy,
+			EjectedUntil: ep.ejectedUntil,
+			Circuit:      ep.breaker.currentState(),
+		})
+	}
+	return statuses
+}
+
+// probe actively checks every endpoint. Any HTTP response means the NRF is
+// reachable; only transport errors eject the endpoint.
+func (p *endpointPool) probe(ctx context.Context, client *http.Client, path string, timeout time.Duration) {
+	p.lock.Lock()
+	endpoints := append([]*endpoint(nil), p.endpoints...)
+	p.lock.Unlock()
+
+	for _, ep := range endpoints {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		req, err := http.NewRequestWithContext(probeCtx, http.MethodGet, ep.url+path, nil)
+		if err != nil {
+			cancel()
+			continue
+		}
+
+		resp, err := client.Do(req)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.markFailure(ep)
+			continue
+		}
+		resp.Body.Close()
+		p.markSuccess(ep)
+	}
+}
@@ -0,0 +1,109 @@
+package consumer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+func candidateURLs(p *endpointPool) []string {
+	var urls []string
+	for _, ep := range p.candidates() {
+		urls = append(urls, ep.url)
+	}
+	return urls
+}
+
+func TestEndpointPoolCandidates(t *testing.T) {
+	urls := []string{"http://nrf-0", "http://nrf-1", "http://nrf-2"}
+
+	tests := []struct {
+		name    string
+		policy  string
+		ejected []int
+		want    [][]string
+	}{
+		{
+			name:   "primary-secondary",
+			policy: PolicyPrimarySecondary,
+			want:   [][]string{urls, urls},
+		},
+		{
+			name:    "primary-secondary with primary ejected",
+			policy:  PolicyPrimarySecondary,
+			ejected: []int{0},
+			want:    [][]string{{"http://nrf-1", "http://nrf-2", "http://nrf-0"}},
+		},
+		{
+			name:   "round-robin",
+			policy: PolicyRoundRobin,
+			want: [][]string{
+				{"http://nrf-0", "http://nrf-1", "http://nrf-2"},
+				{"http://nrf-1", "http://nrf-2", "http://nrf-0"},
+				{"http://nrf-2", "http://nrf-0", "http://nrf-1"},
+				{"http://nrf-0", "http://nrf-1", "http://nrf-2"},
+			},
+		},
+		{
+			name:    "round-robin with ejected endpoint",
+			policy:  PolicyRoundRobin,
+			ejected: []int{1},
+			want: [][]string{
+				{"http://nrf-0", "http://nrf-2", "http://nrf-1"},
+				{"http://nrf-2", "http://nrf-0", "http://nrf-1"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newEndpointPool(urls, tt.policy, time.Minute, &factory.CircuitBreaker{})
+			for _, i := range tt.ejected {
+				p.markFailure(p.endpoints[i])
+			}
+			for call, want := range tt.want {
+				if got := candidateURLs(p); !reflect.DeepEqual(got, want) {
+					t.Errorf("call %d: candidates = %v, want %v", call, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEndpointPoolRecovery(t *testing.T) {
+	p := newEndpointPool([]string{"http://nrf-0", "http://nrf-1"}, PolicyPrimarySecondary,
+		20*time.Millisecond, &factory.CircuitBreaker{})
+
+	p.markFailure(p.endpoints[0])
+	if got := candidateURLs(p); got[0] != "http://nrf-1" {
+		t.Fatalf("candidates = %v, want the ejected primary last", got)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if got := candidateURLs(p); got[0] != "http://nrf-0" {
+		t.Errorf("candidates = %v, want the primary back after the ejection time", got)
+	}
+
+	p.markFailure(p.endpoints[0])
+	p.markSuccess(p.endpoints[0])
+	if status := p.status(); !status[0].Healthy || !status[0].EjectedUntil.IsZero() {
+		t.Errorf("status = %+v, want healthy after a success", status[0])
+	}
+}
+
+func TestEndpointPoolSetURLs(t *testing.T) {
+	p := newEndpointPool([]string{"http://nrf-0", "http://nrf-1"}, PolicyPrimarySecondary,
+		time.Minute, &factory.CircuitBreaker{})
+	kept := p.endpoints[1]
+	p.markFailure(kept)
+
+	p.setURLs([]string{"http://nrf-1", "http://nrf-2"})
+
+	if got := candidateURLs(p); !reflect.DeepEqual(got, []string{"http://nrf-2", "http://nrf-1"}) {
+		t.Errorf("candidates = %v, want the kept endpoint still ejected", got)
+	}
+	if p.endpoints[0] != kept {
+		t.Error("kept endpoint lost its state")
+	}
+}
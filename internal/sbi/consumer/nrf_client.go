@@ -3,79 +3,407 @@ package consumer
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/url"
-
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/metrics"
+	"github.com/free5gc/nfpcf/internal/tracing"
+	"github.com/free5gc/nfpcf/pkg/factory"
 	"github.com/free5gc/openapi/models"
-	"golang.org/x/net/http2"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type NRFClient struct {
-	nrfURL     string
-	httpClient *http.Client
+	endpoints   *endpointPool
+	httpClient  *http.Client
+	healthCheck *factory.HealthCheck
+	timeouts    *factory.NRFTimeouts
+	retry       *factory.Retry
+	tokens      *tokenSource
+	// warmedUp is closed once the first round of health probes completed,
+	// right away when active probing is disabled
+	warmedUp chan struct{}
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewNRFClient creates a client failing over between nrfURLs. http://
+// endpoints use h2c, https:// endpoints nrfConfig.TLS.
+func NewNRFClient(nrfURLs []string, nrfConfig *factory.NRF) (*NRFClient, error) {
+	transport, err := newTransport(nrfConfig.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("NRF TLS config: %w", err)
+	}
+
+	c := &NRFClient{
+		endpoints: newEndpointPool(nrfURLs, nrfConfig.LoadBalancing,
+			nrfConfig.HealthCheck.EjectionTime, nrfConfig.CircuitBreaker),
+		httpClient:  &http.Client{Transport: transport},
+		healthCheck: nrfConfig.HealthCheck,
+		timeouts:    nrfConfig.Timeouts,
+		retry:       nrfConfig.Retry,
+		warmedUp:    make(chan struct{}),
+		stopCh:      make(chan struct{}),
+	}
+
+	if nrfConfig.OAuth2 != nil && nrfConfig.OAuth2.Enable {
+		c.tokens = newTokenSource(nrfConfig.OAuth2)
+	}
+
+	if c.healthCheck.Enable && c.healthCheck.Interval > 0 {
+		go c.runHealthCheck()
+	} else {
+		close(c.warmedUp)
+	}
+
+	return c, nil
+}
+
+func (c *NRFClient) runHealthCheck() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Probe right away so endpoint health is known before the first interval
+	c.endpoints.probe(ctx, c.httpClient, c.healthCheck.Path, c.healthCheck.Timeout)
+	close(c.warmedUp)
+
+	ticker := time.NewTicker(c.healthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.endpoints.probe(ctx, c.httpClient, c.healthCheck.Path, c.healthCheck.Timeout)
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// Healthy reports whether at least one NRF endpoint is currently usable.
+func (c *NRFClient) Healthy() bool {
+	for _, status := range c.endpoints.status() {
+		if status.Healthy {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateEndpoints checks that urls are usable NRF endpoints: absolute
+// http or https URLs, at least one.
+func ValidateEndpoints(urls []string) error {
+	if len(urls) == 0 {
+		return fmt.Errorf("no NRF endpoint")
+	}
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("invalid NRF endpoint %q: %w", u, err)
+		}
+		if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid NRF endpoint %q: want http(s)://host[:port]", u)
+		}
+	}
+	return nil
+}
+
+// SetEndpoints replaces the NRF endpoints, e.g. on a configuration reload.
+// Calls in progress finish on the endpoints they already picked.
+func (c *NRFClient) SetEndpoints(urls []string) error {
+	if err := ValidateEndpoints(urls); err != nil {
+		return err
+	}
+	c.endpoints.setURLs(urls)
+	return nil
+}
+
+// WarmedUp reports whether the endpoint health is known, i.e. the first
+// round of health probes completed.
+func (c *NRFClient) WarmedUp() bool {
+	select {
+	case <-c.warmedUp:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *NRFClient) EndpointStatus() []EndpointStatus {
+	return c.endpoints.status()
 }
 
-func NewNRFClient(nrfURL string) *NRFClient {
-	transport := &http2.Transport{
-		AllowHTTP: true,
-		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
-			return net.Dial(network, addr)
-		},
+func (c *NRFClient) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+}
+
+// do sends a request for the given operation to the backend NRF and
+// records its latency and status.
+func (c *NRFClient) do(
+	ctx context.Context,
+	op string,
+	method string,
+	path string,
+	body []byte,
+	contentType string,
+) (*http.Response, error) {
+	done := metrics.NRFRequestStarted(op)
+
+	urlPath, _, _ := strings.Cut(path, "?")
+	ctx, span := tracing.Tracer().Start(ctx, "NRF "+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("nrf.operation", op),
+			attribute.String("http.request.method", method),
+			attribute.String("url.path", urlPath),
+		))
+	defer span.End()
+
+	resp, err := c.send(ctx, op, method, path, body, contentType)
+	switch {
+	case errors.Is(err, ErrNRFUnavailable):
+		done("unavailable")
+		span.SetStatus(codes.Error, err.Error())
+	case err != nil:
+		done("error")
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	default:
+		done(strconv.Itoa(resp.StatusCode))
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if isServerFailure(resp.StatusCode) {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+
+	return resp, err
+}
+
+// send sends a request to the NRF, once more with a new token if NFPCF's own
+// token is rejected.
+func (c *NRFClient) send(
+	ctx context.Context,
+	op string,
+	method string,
+	path string,
+	body []byte,
+	contentType string,
+) (*http.Response, error) {
+	authorization, err := c.authorization(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.sendAttempts(ctx, op, method, path, body, contentType, authorization)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !c.ownToken(ctx, path) {
+		return resp, err
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	c.invalidateToken(path, authorization)
+	logger.ConsumerLog.Infof("%s %s: NRF rejected the access token, retrying with a new one", method, path)
+
+	if authorization, err = c.authorization(ctx, path); err != nil {
+		return nil, err
+	}
+	return c.sendAttempts(ctx, op, method, path, body, contentType, authorization)
+}
+
+// sendAttempts retries with jittered backoff: idempotent methods on transport
+// errors and 503, others only if the request was never sent.
+func (c *NRFClient) sendAttempts(
+	ctx context.Context,
+	op string,
+	method string,
+	path string,
+	body []byte,
+	contentType string,
+	authorization string,
+) (*http.Response, error) {
+	idempotent := isIdempotent(method)
+	backoff := c.retry.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		resp, sent, err := c.tryEndpoints(ctx, op, method, path, body, contentType, authorization)
+
+		var delay time.Duration
+		if err == nil {
+			if resp.StatusCode != http.StatusServiceUnavailable || !idempotent || attempt >= c.retry.MaxAttempts {
+				return resp, nil
+			}
+
+			delay = jitter(backoff)
+			if after, ok := retryAfter(resp); ok {
+				if !canWait(ctx, after, c.retry.MaxBackoff) {
+					logger.ConsumerLog.Warnf("%s %s: NRF returned 503 with Retry-After %s, not retrying",
+						method, path, after)
+					return resp, nil
+				}
+				delay = after
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			logger.ConsumerLog.Warnf("%s %s: NRF returned 503, retrying in %s (attempt %d/%d)",
+				method, path, delay, attempt, c.retry.MaxAttempts)
+			trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+				attribute.Int("attempt", attempt), attribute.String("reason", "503")))
+		} else {
+			if errors.Is(err, ErrNRFUnavailable) {
+				return nil, err
+			}
+			if ctx.Err() != nil || attempt >= c.retry.MaxAttempts || (!idempotent && sent) {
+				return nil, err
+			}
+
+			delay = jitter(backoff)
+			logger.ConsumerLog.Warnf("%s %s: %v, retrying in %s (attempt %d/%d)",
+				method, path, err, delay, attempt, c.retry.MaxAttempts)
+			trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+				attribute.Int("attempt", attempt), attribute.String("reason", err.Error())))
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, fmt.Errorf("send request: %w", err)
+		}
+
+		backoff = time.Duration(float64(backoff) * c.retry.Multiplier)
+		if backoff > c.retry.MaxBackoff {
+			backoff = c.retry.MaxBackoff
+		}
+	}
+}
+
+// tryEndpoints sends one attempt across the usable endpoints. The second
+// result reports whether the request may have reached an NRF.
+func (c *NRFClient) tryEndpoints(
+	ctx context.Context,
+	op string,
+	method string,
+	path string,
+	body []byte,
+	contentType string,
+	authorization string,
+) (*http.Response, bool, error) {
+	idempotent := isIdempotent(method)
+	// Set by the transport, possibly after Do returned
+	var sent atomic.Bool
+
+	var lastErr error
+	for _, ep := range c.endpoints.candidates() {
+		if !ep.breaker.allow() {
+			continue
+		}
+
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.timeouts.For(op))
+		trace := &httptrace.ClientTrace{
+			WroteHeaders: func() { sent.Store(true) },
+		}
+
+		req, err := http.NewRequestWithContext(httptrace.WithClientTrace(attemptCtx, trace), method, ep.url+path, bodyReader)
+		if err != nil {
+			cancel()
+			ep.breaker.release()
+			return nil, false, fmt.Errorf("create request: %w", err)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		tracing.Inject(ctx, req.Header)
+
+		resp, err := c.httpClient.Do(req)
+		if err == nil {
+			ep.breaker.record(!isServerFailure(resp.StatusCode))
+			c.endpoints.markSuccess(ep)
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, true, nil
+		}
+		cancel()
+
+		if ctx.Err() != nil {
+			// The caller gave up; this says nothing about the NRF
+			ep.breaker.release()
+			return nil, sent.Load(), fmt.Errorf("send request: %w", err)
+		}
+
+		ep.breaker.record(false)
+
+		logger.ConsumerLog.Warnf("%s %s: NRF endpoint %s failed: %v", method, path, ep.url, err)
+		c.endpoints.markFailure(ep)
+		lastErr = err
+
+		if !idempotent && sent.Load() {
+			break
+		}
 	}
 
-	return &NRFClient{
-		nrfURL:     nrfURL,
-		httpClient: &http.Client{Transport: transport},
+	if lastErr == nil {
+		return nil, false, ErrNRFUnavailable
 	}
+	return nil, sent.Load(), fmt.Errorf("send request: %w", lastErr)
 }
 
 func (c *NRFClient) RegisterNF(
 	ctx context.Context,
 	nfProfile *models.NrfNfManagementNfProfile,
 ) (*models.NrfNfManagementNfProfile, *models.ProblemDetails, error) {
-	url := fmt.Sprintf("%s/nnrf-nfm/v1/nf-instances/%s", c.nrfURL, nfProfile.NfInstanceId)
+	path := fmt.Sprintf("/nnrf-nfm/v1/nf-instances/%s", nfProfile.NfInstanceId)
 
 	body, err := json.Marshal(nfProfile)
 	if err != nil {
 		return nil, nil, fmt.Errorf("marshal profile: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewBuffer(body))
+	resp, err := c.do(ctx, OpRegister, "PUT", path, body, "application/json")
 	if err != nil {
-		return nil, nil, fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		fmt.Printf("[NFPCF] RegisterNF: send request error: %v\n", err)
-		return nil, nil, fmt.Errorf("send request: %w", err)
+		logger.ConsumerLog.Errorf("RegisterNF: send request error: %v", err)
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	fmt.Printf("[NFPCF] RegisterNF: got response status %d, proto %s\n", resp.StatusCode, resp.Proto)
-
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("[NFPCF] RegisterNF: read response error: %v\n", err)
+		logger.ConsumerLog.Errorf("RegisterNF: read response error: %v", err)
 		return nil, nil, fmt.Errorf("read response: %w", err)
 	}
 
-	fmt.Printf("[NFPCF] RegisterNF: response body length: %d\n", len(respBody))
+	logger.ConsumerLog.WithFields(logrus.Fields{
+		"status":   resp.StatusCode,
+		"proto":    resp.Proto,
+		"bodySize": len(respBody),
+	}).Debug("RegisterNF: got response")
 
 	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
 		var profile models.NrfNfManagementNfProfile
 		if err := json.Unmarshal(respBody, &profile); err != nil {
-			fmt.Printf("[NFPCF] RegisterNF: unmarshal error: %v, body: %s\n", err, string(respBody))
+			logger.ConsumerLog.Errorf("RegisterNF: unmarshal error: %v (%d bytes)", err, len(respBody))
 			return nil, nil, fmt.Errorf("unmarshal response: %w", err)
 		}
-		fmt.Printf("[NFPCF] RegisterNF: successfully parsed profile %s\n", profile.NfInstanceId)
+		logger.ConsumerLog.Infof("RegisterNF: registered NF instance %s", profile.NfInstanceId)
 		return &profile, nil, nil
 	}
 
@@ -91,16 +419,11 @@ func (c *NRFClient) GetNFInstance(
 	ctx context.Context,
 	nfInstanceID string,
 ) (*models.NrfNfManagementNfProfile, *models.ProblemDetails, error) {
-	url := fmt.Sprintf("%s/nnrf-nfm/v1/nf-instances/%s", c.nrfURL, nfInstanceID)
-
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, nil, fmt.Errorf("create request: %w", err)
-	}
+	path := fmt.Sprintf("/nnrf-nfm/v1/nf-instances/%s", nfInstanceID)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(ctx, OpGet, "GET", path, nil, "")
 	if err != nil {
-		return nil, nil, fmt.Errorf("send request: %w", err)
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
@@ -125,17 +448,55 @@ func (c *NRFClient) GetNFInstance(
 	return nil, nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 }
 
-func (c *NRFClient) DeregisterNF(ctx context.Context, nfInstanceID string) (*models.ProblemDetails, error) {
-	url := fmt.Sprintf("%s/nnrf-nfm/v1/nf-instances/%s", c.nrfURL, nfInstanceID)
+// GetNFInstances retrieves the URIs of the registered NF instances
+// (NFListRetrieval), filtered by the nf-type and limit query parameters.
+func (c *NRFClient) GetNFInstances(
+	ctx context.Context,
+	queryParams url.Values,
+) (*models.UriList, *models.ProblemDetails, error) {
+	path := "/nnrf-nfm/v1/nf-instances"
+	if len(queryParams) > 0 {
+		path += "?" + queryParams.Encode()
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
+	resp, err := c.do(ctx, OpGet, "GET", path, nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	// 204 is an empty list
+	if resp.StatusCode == http.StatusNoContent {
+		return &models.UriList{}, nil, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		var uriList models.UriList
+		if err := json.Unmarshal(respBody, &uriList); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal response: %w", err)
+		}
+		return &uriList, nil, nil
+	}
+
+	var problemDetails models.ProblemDetails
+	if err := json.Unmarshal(respBody, &problemDetails); err == nil {
+		return nil, &problemDetails, nil
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return nil, nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+}
+
+func (c *NRFClient) DeregisterNF(ctx context.Context, nfInstanceID string) (*models.ProblemDetails, error) {
+	path := fmt.Sprintf("/nnrf-nfm/v1/nf-instances/%s", nfInstanceID)
+
+	resp, err := c.do(ctx, OpDeregister, "DELETE", path, nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -160,50 +521,47 @@ func (c *NRFClient) DiscoverNF(
 	ctx context.Context,
 	queryParams url.Values,
 ) (*models.SearchResult, *models.ProblemDetails, error) {
-	url := fmt.Sprintf("%s/nnrf-disc/v1/nf-instances?%s", c.nrfURL, queryParams.Encode())
+	path := fmt.Sprintf("/nnrf-disc/v1/nf-instances?%s", queryParams.Encode())
 
-	fmt.Printf("[NFPCF] DiscoverNF: querying %s\n", url)
+	logger.ConsumerLog.Debugf("DiscoverNF: querying %s", path)
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	resp, err := c.do(ctx, OpDiscover, "GET", path, nil, "")
 	if err != nil {
-		fmt.Printf("[NFPCF] DiscoverNF: create request error: %v\n", err)
-		return nil, nil, fmt.Errorf("create request: %w", err)
-	}
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		fmt.Printf("[NFPCF] DiscoverNF: send request error: %v\n", err)
-		return nil, nil, fmt.Errorf("send request: %w", err)
+		logger.ConsumerLog.Errorf("DiscoverNF: send request error: %v", err)
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
-	fmt.Printf("[NFPCF] DiscoverNF: got response status %d, proto %s\n", resp.StatusCode, resp.Proto)
-
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("[NFPCF] DiscoverNF: read response error: %v\n", err)
+		logger.ConsumerLog.Errorf("DiscoverNF: read response error: %v", err)
 		return nil, nil, fmt.Errorf("read response: %w", err)
 	}
 
-	fmt.Printf("[NFPCF] DiscoverNF: response body length: %d\n", len(respBody))
+	logger.ConsumerLog.WithFields(logrus.Fields{
+		"status":   resp.StatusCode,
+		"proto":    resp.Proto,
+		"bodySize": len(respBody),
+	}).Debug("DiscoverNF: got response")
 
 	if resp.StatusCode == http.StatusOK {
 		var searchResult models.SearchResult
 		if err := json.Unmarshal(respBody, &searchResult); err != nil {
-			fmt.Printf("[NFPCF] DiscoverNF: unmarshal error: %v, body: %s\n", err, string(respBody))
+			logger.ConsumerLog.Errorf("DiscoverNF: unmarshal error: %v (%d bytes)", err, len(respBody))
 			return nil, nil, fmt.Errorf("unmarshal response: %w", err)
 		}
-		fmt.Printf("[NFPCF] DiscoverNF: found %d NF instances\n", len(searchResult.NfInstances))
+		logger.ConsumerLog.Debugf("DiscoverNF: found %d NF instances", len(searchResult.NfInstances))
 		return &searchResult, nil, nil
 	}
 
 	var problemDetails models.ProblemDetails
 	if err := json.Unmarshal(respBody, &problemDetails); err == nil {
-		fmt.Printf("[NFPCF] DiscoverNF: got problem details: status=%d, cause=%s\n", problemDetails.Status, problemDetails.Cause)
+		logger.ConsumerLog.Infof("DiscoverNF: got problem details: status=%d, cause=%s",
+			problemDetails.Status, problemDetails.Cause)
 		return nil, &problemDetails, nil
 	}
 
-	fmt.Printf("[NFPCF] DiscoverNF: unexpected status %d, body: %s\n", resp.StatusCode, string(respBody))
+	logger.ConsumerLog.Warnf("DiscoverNF: unexpected status %d (%d bytes)", resp.StatusCode, len(respBody))
 	return nil, nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 }
 
@@ -212,18 +570,11 @@ func (c *NRFClient) UpdateNFInstance(
 	nfInstanceID string,
 	patchData []byte,
 ) (*models.NrfNfManagementNfProfile, error) {
-	url := fmt.Sprintf("%s/nnrf-nfm/v1/nf-instances/%s", c.nrfURL, nfInstanceID)
+	path := fmt.Sprintf("/nnrf-nfm/v1/nf-instances/%s", nfInstanceID)
 
-	req, err := http.NewRequestWithContext(ctx, "PATCH", url, bytes.NewBuffer(patchData))
+	resp, err := c.do(ctx, OpUpdate, "PATCH", path, patchData, "application/json-patch+json")
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
-	}
-
-	req.Header.Set("Content-Type", "application/json-patch+json")
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("send request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -246,3 +597,40 @@ func (c *NRFClient) UpdateNFInstance(
 
 	return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
 }
+
+func (c *NRFClient) RetrieveStoredSearch(
+	ctx context.Context,
+	searchID string,
+	complete bool,
+) (*models.StoredSearchResult, *models.ProblemDetails, error) {
+	path := fmt.Sprintf("/nnrf-disc/v1/searches/%s", searchID)
+	if complete {
+		path += "/complete-stored-search"
+	}
+
+	resp, err := c.do(ctx, OpDiscover, "GET", path, nil, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		var storedSearch models.StoredSearchResult
+		if err := json.Unmarshal(respBody, &storedSearch); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal response: %w", err)
+		}
+		return &storedSearch, nil, nil
+	}
+
+	var problemDetails models.ProblemDetails
+	if err := json.Unmarshal(respBody, &problemDetails); err == nil {
+		return nil, &problemDetails, nil
+	}
+
+	return nil, nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+}
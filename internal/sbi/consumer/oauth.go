@@ -0,0 +1,228 @@
+package consumer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+const (
+	OpToken = "token"
+
+	accessTokenPath = "/oauth2/token"
+)
+
+type consumerTokenKey struct{}
+
+// WithConsumerToken stores the Authorization header of an inbound request so
+// that it can be forwarded to the NRF when NFPCF acts transparently.
+func WithConsumerToken(ctx context.Context, authorization string) context.Context {
+	if authorization == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, consumerTokenKey{}, authorization)
+}
+
+func consumerToken(ctx context.Context) string {
+	authorization, _ := ctx.Value(consumerTokenKey{}).(string)
+	return authorization
+}
+
+// scopeForPath maps an NRF resource to the service name used as OAuth2
+// scope (TS 33.501): nnrf-nfm or nnrf-disc.
+func scopeForPath(path string) string {
+	service, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	return service
+}
+
+type cachedToken struct {
+	accessToken string
+	tokenType   string
+	expiresAt   time.Time
+}
+
+// header returns the Authorization header carrying the token.
+func (t *cachedToken) header() string {
+	return t.tokenType + " " + t.accessToken
+}
+
+// tokenRequest is a token request in progress, shared by the requests
+// needing a token for the same scope meanwhile.
+type tokenRequest struct {
+	done  chan struct{}
+	token *cachedToken
+	err   error
+}
+
+// tokenSource obtains and caches NFPCF's own access tokens per scope.
+type tokenSource struct {
+	config   *factory.OAuth2
+	tokens   map[string]*cachedToken
+	requests map[string]*tokenRequest
+	lock     sync.Mutex
+}
+
+func newTokenSource(config *factory.OAuth2) *tokenSource {
+	return &tokenSource{
+		config:   config,
+		tokens:   make(map[string]*cachedToken),
+		requests: make(map[string]*tokenRequest),
+	}
+}
+
+// ownToken reports whether requests to path carry NFPCF's own access token,
+// as opposed to none or the consumer's.
+func (c *NRFClient) ownToken(ctx context.Context, path string) bool {
+	if c.tokens == nil || strings.HasPrefix(path, accessTokenPath) {
+		return false
+	}
+	return !c.tokens.config.ForwardConsumerToken || consumerToken(ctx) == ""
+}
+
+// authorization returns the Authorization header to send to the NRF for the
+// given path, or "" when no token is needed.
+func (c *NRFClient) authorization(ctx context.Context, path string) (string, error) {
+	if c.tokens == nil || strings.HasPrefix(path, accessTokenPath) {
+		return "", nil
+	}
+	if !c.ownToken(ctx, path) {
+		return consumerToken(ctx), nil
+	}
+
+	scope := scopeForPath(path)
+
+	c.tokens.lock.Lock()
+	if token, exists := c.tokens.tokens[scope]; exists && time.Now().Before(token.expiresAt) {
+		c.tokens.lock.Unlock()
+		return token.header(), nil
+	}
+	request, pending := c.tokens.requests[scope]
+	if !pending {
+		request = &tokenRequest{done: make(chan struct{})}
+		c.tokens.requests[scope] = request
+		// Shared by every waiter, so not cancelled with the first of them
+		go c.fetchToken(context.WithoutCancel(ctx), scope, request)
+	}
+	c.tokens.lock.Unlock()
+
+	select {
+	case <-request.done:
+	case <-ctx.Done():
+		return "", fmt.Errorf("get access token for %s: %w", scope, ctx.Err())
+	}
+
+	if request.err != nil {
+		return "", fmt.Errorf("get access token for %s: %w", scope, request.err)
+	}
+	return request.token.header(), nil
+}
+
+// fetchToken completes request with a new token for scope and caches it.
+func (c *NRFClient) fetchToken(ctx context.Context, scope string, request *tokenRequest) {
+	request.token, request.err = c.requestToken(ctx, scope)
+
+	c.tokens.lock.Lock()
+	if request.err == nil {
+		c.tokens.tokens[scope] = request.token
+	}
+	delete(c.tokens.requests, scope)
+	c.tokens.lock.Unlock()
+	close(request.done)
+}
+
+// invalidateToken drops the cached token of the path's scope if it is the
+// rejected one.
+func (c *NRFClient) invalidateToken(path string, authorization string) {
+	scope := scopeForPath(path)
+
+	c.tokens.lock.Lock()
+	defer c.tokens.lock.Unlock()
+
+	if token, exists := c.tokens.tokens[scope]; exists && token.header() == authorization {
+		delete(c.tokens.tokens, scope)
+	}
+}
+
+func (c *NRFClient) requestToken(ctx context.Context, scope string) (*cachedToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("nfInstanceId", c.tokens.config.NfInstanceID)
+	form.Set("nfType", c.tokens.config.NfType)
+	form.Set("targetNfType", "NRF")
+	form.Set("scope", scope)
+
+	tokenRsp, tokenErr, _, err := c.RequestAccessToken(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+	if tokenErr != nil {
+		return nil, fmt.Errorf("token request rejected: %s", tokenErr.Error)
+	}
+
+	tokenType := tokenRsp.TokenType
+	if tokenType == "" || strings.EqualFold(tokenType, "bearer") {
+		tokenType = "Bearer"
+	}
+
+	expiresIn := time.Duration(tokenRsp.ExpiresIn) * time.Second
+	if expiresIn == 0 {
+		expiresIn = c.tokens.config.DefaultExpiry
+	}
+
+	margin := c.tokens.config.ExpiryMargin
+	if margin >= expiresIn {
+		margin = expiresIn / 2
+	}
+
+	logger.ConsumerLog.Debugf("Obtained access token for scope %s, expires in %s", scope, expiresIn)
+
+	return &cachedToken{
+		accessToken: tokenRsp.AccessToken,
+		tokenType:   tokenType,
+		expiresAt:   time.Now().Add(expiresIn - margin),
+	}, nil
+}
+
+// RequestAccessToken forwards a consumer's AccessTokenReq (form encoded) to
+// the NRF. Token errors are returned as AccessTokenErr with the NRF status.
+func (c *NRFClient) RequestAccessToken(
+	ctx context.Context,
+	form url.Values,
+) (*models.NrfAccessTokenAccessTokenRsp, *models.AccessTokenErr, int, error) {
+	resp, err := c.do(ctx, OpToken, "POST", accessTokenPath, []byte(form.Encode()),
+		"application/x-www-form-urlencoded")
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		var tokenRsp models.NrfAccessTokenAccessTokenRsp
+		if err := json.Unmarshal(respBody, &tokenRsp); err != nil {
+			return nil, nil, 0, fmt.Errorf("unmarshal response: %w", err)
+		}
+		return &tokenRsp, nil, resp.StatusCode, nil
+	}
+
+	var tokenErr models.AccessTokenErr
+	if err := json.Unmarshal(respBody, &tokenErr); err == nil && tokenErr.Error != "" {
+		return nil, &tokenErr, resp.StatusCode, nil
+	}
+
+	return nil, nil, 0, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+}
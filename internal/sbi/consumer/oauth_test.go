@@ -0,0 +1,142 @@
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+// newTokenNRF serves access tokens token-1, token-2, ... and discoveries,
+// answering 401 to the discoveries whose bearer token rejected refuses. It
+// counts the token requests and the discoveries.
+func newTokenNRF(t *testing.T, rejected func(token string) bool) (string, *atomic.Int64, *atomic.Int64) {
+	t.Helper()
+	var tokens, discoveries atomic.Int64
+	nrf, _ := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == accessTokenPath {
+			n := tokens.Add(1)
+			// Long enough for concurrent requests to wait for it
+			time.Sleep(50 * time.Millisecond)
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"Bearer","expires_in":3600}`, n)
+			return
+		}
+
+		discoveries.Add(1)
+		if rejected(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status":401,"cause":"UNAUTHORIZED"}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"nfInstances":[]}`))
+	})
+	return nrf.URL, &tokens, &discoveries
+}
+
+func newOAuth2Client(t *testing.T, nrfURL string, forwardConsumerToken bool) *NRFClient {
+	t.Helper()
+	nrfConfig := testNRFConfig(nrfURL)
+	nrfConfig.OAuth2 = &factory.OAuth2{
+		Enable:               true,
+		NfInstanceID:         "nfpcf-1",
+		NfType:               "SCP",
+		ExpiryMargin:         time.Second,
+		DefaultExpiry:        time.Minute,
+		ForwardConsumerToken: forwardConsumerToken,
+	}
+	return newTestClient(t, nrfConfig)
+}
+
+func TestTokenRequestIsShared(t *testing.T) {
+	nrfURL, tokens, discoveries := newTokenNRF(t, func(string) bool { return false })
+	client := newOAuth2Client(t, nrfURL, false)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := client.DiscoverNF(context.Background(), url.Values{"target-nf-type": {"SMF"}}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := tokens.Load(); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+	if got := discoveries.Load(); got != 10 {
+		t.Errorf("discoveries = %d, want 10", got)
+	}
+}
+
+func TestUnauthorizedRetriesWithNewToken(t *testing.T) {
+	tests := []struct {
+		name            string
+		rejected        func(token string) bool
+		consumerToken   string
+		wantStatus      int
+		wantTokens      int64
+		wantDiscoveries int64
+	}{
+		{
+			name:            "new token accepted",
+			rejected:        func(token string) bool { return token == "token-1" },
+			wantStatus:      http.StatusOK,
+			wantTokens:      2,
+			wantDiscoveries: 2,
+		},
+		{
+			name:            "retried once",
+			rejected:        func(string) bool { return true },
+			wantStatus:      http.StatusUnauthorized,
+			wantTokens:      2,
+			wantDiscoveries: 2,
+		},
+		{
+			name:            "consumer token is not replaced",
+			rejected:        func(string) bool { return true },
+			consumerToken:   "Bearer consumer",
+			wantStatus:      http.StatusUnauthorized,
+			wantTokens:      0,
+			wantDiscoveries: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrfURL, tokens, discoveries := newTokenNRF(t, tt.rejected)
+			client := newOAuth2Client(t, nrfURL, true)
+
+			ctx := WithConsumerToken(context.Background(), tt.consumerToken)
+			_, problemDetails, err := client.DiscoverNF(ctx, url.Values{"target-nf-type": {"SMF"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			status := http.StatusOK
+			if problemDetails != nil {
+				status = int(problemDetails.Status)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if got := tokens.Load(); got != tt.wantTokens {
+				t.Errorf("token requests = %d, want %d", got, tt.wantTokens)
+			}
+			if got := discoveries.Load(); got != tt.wantDiscoveries {
+				t.Errorf("discoveries = %d, want %d", got, tt.wantDiscoveries)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package consumer
+
+import (
+	"fmt"
+
+	"github.com/free5gc/openapi/models"
+)
+
+// PLMNRouter selects the NRF that serves discoveries for target PLMNs.
+type PLMNRouter struct {
+	home           *NRFClient
+	homePlmns      map[string]bool
+	routes         map[string]*NRFClient
+	defaultRoaming *NRFClient
+}
+
+// NewPLMNRouter builds a router. homePlmns and routes are keyed by
+// "mcc-mnc"; defaultRoaming may be nil.
+func NewPLMNRouter(
+	home *NRFClient,
+	homePlmns []string,
+	routes map[string]*NRFClient,
+	defaultRoaming *NRFClient,
+) *PLMNRouter {
+	r := &PLMNRouter{
+		home:           home,
+		homePlmns:      make(map[string]bool, len(homePlmns)),
+		routes:         routes,
+		defaultRoaming: defaultRoaming,
+	}
+	for _, plmn := range homePlmns {
+		r.homePlmns[plmn] = true
+	}
+	return r
+}
+
+// Targets of Route besides the "mcc-mnc" of a PLMN route.
+const (
+	HomeNRF    = ""
+	RoamingNRF = "roaming"
+)
+
+// Route returns the NRF client serving targetPlmns and its target name.
+// PLMNs served by different NRFs are rejected.
+func (r *PLMNRouter) Route(targetPlmns []models.PlmnId) (*NRFClient, string, error) {
+	target := HomeNRF
+	for i, plmn := range targetPlmns {
+		key := plmn.Mcc + "-" + plmn.Mnc
+		plmnTarget, err := r.target(key)
+		if err != nil {
+			return nil, "", err
+		}
+		if i > 0 && plmnTarget != target {
+			return nil, "", fmt.Errorf("PLMNs of target-plmn-list are served by different NRFs")
+		}
+		target = plmnTarget
+	}
+
+	return r.Client(target), target, nil
+}
+
+func (r *PLMNRouter) target(plmn string) (string, error) {
+	switch {
+	case r.homePlmns[plmn]:
+		return HomeNRF, nil
+	case r.routes[plmn] != nil:
+		return plmn, nil
+	case r.defaultRoaming != nil:
+		return RoamingNRF, nil
+	}
+	return "", fmt.Errorf("no NRF route for PLMN %s", plmn)
+}
+
+// Client returns the NRF client of a target returned by Route, or the home
+// NRF client if the target is no longer configured.
+func (r *PLMNRouter) Client(target string) *NRFClient {
+	if target == RoamingNRF && r.defaultRoaming != nil {
+		return r.defaultRoaming
+	}
+	if client, exists := r.routes[target]; exists {
+		return client
+	}
+	return r.home
+}
+
+// Stop stops the home NRF client and the clients of all remote NRFs.
+func (r *PLMNRouter) Stop() {
+	r.home.Stop()
+	for _, client := range r.routes {
+		client.Stop()
+	}
+	if r.defaultRoaming != nil {
+		r.defaultRoaming.Stop()
+	}
+}
@@ -0,0 +1,53 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func TestPLMNRouterRoute(t *testing.T) {
+	home := &NRFClient{}
+	route := &NRFClient{}
+	roaming := &NRFClient{}
+
+	homePlmn := models.PlmnId{Mcc: "208", Mnc: "93"}
+	routedPlmn := models.PlmnId{Mcc: "001", Mnc: "01"}
+	otherPlmn := models.PlmnId{Mcc: "310", Mnc: "410"}
+	secondOther := models.PlmnId{Mcc: "440", Mnc: "10"}
+
+	tests := []struct {
+		name       string
+		roaming    *NRFClient
+		plmns      []models.PlmnId
+		wantClient *NRFClient
+		wantTarget string
+		wantErr    bool
+	}{
+		{"no PLMN", roaming, nil, home, HomeNRF, false},
+		{"home PLMN", roaming, []models.PlmnId{homePlmn}, home, HomeNRF, false},
+		{"routed PLMN", roaming, []models.PlmnId{routedPlmn}, route, "001-01", false},
+		{"routed PLMN twice", roaming, []models.PlmnId{routedPlmn, routedPlmn}, route, "001-01", false},
+		{"unrouted PLMN", roaming, []models.PlmnId{otherPlmn}, roaming, RoamingNRF, false},
+		{"unrouted PLMNs share the roaming NRF", roaming, []models.PlmnId{otherPlmn, secondOther}, roaming, RoamingNRF, false},
+		{"unrouted PLMN without roaming NRF", nil, []models.PlmnId{otherPlmn}, nil, "", true},
+		{"home and routed PLMN", roaming, []models.PlmnId{homePlmn, routedPlmn}, nil, "", true},
+		{"routed and unrouted PLMN", roaming, []models.PlmnId{routedPlmn, otherPlmn}, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := NewPLMNRouter(home, []string{"208-93"}, map[string]*NRFClient{"001-01": route}, tt.roaming)
+
+			client, target, err := router.Route(tt.plmns)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Route() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if client != tt.wantClient || target != tt.wantTarget {
+				t.Errorf("Route() = %p, %q, want %p, %q", client, target, tt.wantClient, tt.wantTarget)
+			}
+			if err == nil && router.Client(target) != client {
+				t.Errorf("Client(%q) is not the routed client", target)
+			}
+		})
+	}
+}
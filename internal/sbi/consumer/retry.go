@@ -0,0 +1,99 @@
+package consumer
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+// Operations of the NRFClient, used to select per-operation timeouts.
+const (
+	OpRegister   = factory.OpRegister
+	OpGet        = factory.OpGet
+	OpDeregister = factory.OpDeregister
+	OpUpdate     = factory.OpUpdate
+	OpDiscover   = factory.OpDiscover
+	OpSubscribe  = factory.OpSubscribe
+)
+
+// isIdempotent reports whether a request may be sent again after the NRF
+// may have received it.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// jitter returns a random duration in [d/2, d].
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter parses the Retry-After header of a response, given either in
+// seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		if d := time.Until(date); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// canWait reports whether a Retry-After of d is worth honoring: it must not
+// exceed maxBackoff nor the time left before the deadline of ctx.
+func canWait(ctx context.Context, d time.Duration, maxBackoff time.Duration) bool {
+	if d > maxBackoff {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && d >= time.Until(deadline) {
+		return false
+	}
+	return true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// cancelOnClose releases the per-attempt timeout context once the response
+// body has been consumed by the caller.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
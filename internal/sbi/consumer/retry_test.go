@@ -0,0 +1,166 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+// newStubNRF serves handler over h2c, as the NRF client expects, and counts
+// the requests it received.
+func newStubNRF(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var requests atomic.Int64
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler(w, r)
+	}), &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func testNRFConfig(url string) *factory.NRF {
+	return &factory.NRF{
+		URL:            url,
+		LoadBalancing:  PolicyPrimarySecondary,
+		HealthCheck:    &factory.HealthCheck{Path: "/", EjectionTime: time.Second},
+		Timeouts:       &factory.NRFTimeouts{Default: 2 * time.Second},
+		Retry:          &factory.Retry{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Second, Multiplier: 2},
+		CircuitBreaker: &factory.CircuitBreaker{},
+	}
+}
+
+func newTestClient(t *testing.T, nrfConfig *factory.NRF) *NRFClient {
+	t.Helper()
+	client, err := NewNRFClient([]string{nrfConfig.URL}, nrfConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(client.Stop)
+	return client
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"absent", "", 0, false},
+		{"seconds", "3", 3 * time.Second, true},
+		{"zero", "0", 0, true},
+		{"negative", "-1", 0, false},
+		{"past date", "Mon, 02 Jan 2006 15:04:05 GMT", 0, true},
+		{"garbage", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := retryAfter(resp)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCanWait(t *testing.T) {
+	withDeadline, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		d    time.Duration
+		want bool
+	}{
+		{"within max backoff", context.Background(), time.Second, true},
+		{"beyond max backoff", context.Background(), 10 * time.Second, false},
+		{"within deadline", withDeadline, time.Second, true},
+		{"beyond deadline", withDeadline, 3 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canWait(tt.ctx, tt.d, 5*time.Second); got != tt.want {
+				t.Errorf("canWait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, d := range []time.Duration{0, time.Nanosecond, time.Millisecond, time.Second} {
+		for range 100 {
+			if got := jitter(d); got < d/2 || got > d {
+				t.Fatalf("jitter(%s) = %s, want within [%s, %s]", d, got, d/2, d)
+			}
+		}
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryAfter   string
+		failures     int64
+		wantStatus   int
+		wantRequests int64
+	}{
+		{"503 is retried", "", 1, http.StatusOK, 2},
+		{"short Retry-After is honored", "0", 1, http.StatusOK, 2},
+		{"Retry-After beyond max backoff", "3600", 1, http.StatusServiceUnavailable, 1},
+		{"attempts are bounded", "", 5, http.StatusServiceUnavailable, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen atomic.Int64
+			nrf, requests := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+				if seen.Add(1) <= tt.failures {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.Header().Set("Content-Type", "application/problem+json")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					_, _ = w.Write([]byte(`{"status":503,"cause":"NF_CONGESTION"}`))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"nfInstances":[]}`))
+			})
+			client := newTestClient(t, testNRFConfig(nrf.URL))
+
+			start := time.Now()
+			_, problemDetails, err := client.DiscoverNF(context.Background(), url.Values{"target-nf-type": {"SMF"}})
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("DiscoverNF() took %s", elapsed)
+			}
+
+			status := http.StatusOK
+			if err != nil {
+				t.Fatal(err)
+			}
+			if problemDetails != nil {
+				status = int(problemDetails.Status)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
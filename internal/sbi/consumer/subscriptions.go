@@ -0,0 +1,167 @@
+package consumer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+func (c *NRFClient) CreateSubscription(
+	ctx context.Context,
+	subscription *models.NrfNfManagementSubscriptionData,
+) (*models.NrfNfManagementSubscriptionData, *models.ProblemDetails, error) {
+	body, err := json.Marshal(subscription)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal subscription: %w", err)
+	}
+
+	resp, err := c.do(ctx, OpSubscribe, "POST", "/nnrf-nfm/v1/subscriptions", body, "application/json")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusCreated {
+		var created models.NrfNfManagementSubscriptionData
+		if err := json.Unmarshal(respBody, &created); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal response: %w", err)
+		}
+		return &created, nil, nil
+	}
+
+	var problemDetails models.ProblemDetails
+	if err := json.Unmarshal(respBody, &problemDetails); err == nil {
+		return nil, &problemDetails, nil
+	}
+
+	return nil, nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+}
+
+// UpdateSubscription renews a subscription. A nil subscription without error
+// means the NRF accepted the requested validity.
+func (c *NRFClient) UpdateSubscription(
+	ctx context.Context,
+	subscriptionID string,
+	patchData []byte,
+) (*models.NrfNfManagementSubscriptionData, *models.ProblemDetails, error) {
+	path := fmt.Sprintf("/nnrf-nfm/v1/subscriptions/%s", subscriptionID)
+
+	resp, err := c.do(ctx, OpSubscribe, "PATCH", path, patchData, "application/json-patch+json")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		var updated models.NrfNfManagementSubscriptionData
+		if err := json.Unmarshal(respBody, &updated); err != nil {
+			return nil, nil, fmt.Errorf("unmarshal response: %w", err)
+		}
+		return &updated, nil, nil
+	}
+
+	var problemDetails models.ProblemDetails
+	if err := json.Unmarshal(respBody, &problemDetails); err == nil {
+		return nil, &problemDetails, nil
+	}
+
+	return nil, nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+}
+
+func (c *NRFClient) RemoveSubscription(ctx context.Context, subscriptionID string) (*models.ProblemDetails, error) {
+	path := fmt.Sprintf("/nnrf-nfm/v1/subscriptions/%s", subscriptionID)
+
+	resp, err := c.do(ctx, OpSubscribe, "DELETE", path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	var problemDetails models.ProblemDetails
+	if err := json.Unmarshal(respBody, &problemDetails); err == nil {
+		return &problemDetails, nil
+	}
+
+	return nil, fmt.Errorf("unexpected status: %d", resp.StatusCode)
+}
+
+// Notifier delivers NFStatusNotify callbacks to the notification URIs of
+// local subscribers, over h2c or TLS like the NRF client.
+type Notifier struct {
+	httpClient *http.Client
+	timeout    time.Duration
+}
+
+func NewNotifier(tlsConfig *factory.ClientTLS, timeout time.Duration) (*Notifier, error) {
+	transport, err := newTransport(tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("notifier TLS config: %w", err)
+	}
+
+	return &Notifier{
+		httpClient: &http.Client{Transport: transport},
+		timeout:    timeout,
+	}, nil
+}
+
+func (n *Notifier) NotifyNFStatus(
+	ctx context.Context,
+	uri string,
+	notification *models.NrfNfManagementNotificationData,
+) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uri, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/free5gc/nfpcf/internal/tlsutil"
+	"github.com/free5gc/nfpcf/pkg/factory"
+	"golang.org/x/net/http2"
+)
+
+// schemeTransport sends http:// requests as HTTP/2 cleartext (h2c, prior
+// knowledge) and https:// requests as HTTP/2 over TLS.
+type schemeTransport struct {
+	h2c *http2.Transport
+	tls *http2.Transport
+}
+
+func (t *schemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" {
+		return t.tls.RoundTrip(req)
+	}
+	return t.h2c.RoundTrip(req)
+}
+
+func newTransport(tlsConfig *factory.ClientTLS) (http.RoundTripper, error) {
+	clientTLS, err := newClientTLSConfig(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemeTransport{
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+		tls: &http2.Transport{
+			TLSClientConfig: clientTLS,
+		},
+	}, nil
+}
+
+// newClientTLSConfig builds the TLS settings used toward https:// NRFs.
+func newClientTLSConfig(cfg *factory.ClientTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg == nil {
+		return tlsConfig, nil
+	}
+
+	minVersion, err := tlsutil.ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig.MinVersion = minVersion
+	tlsConfig.ServerName = cfg.ServerName
+
+	if cfg.CACert != "" {
+		pool, err := tlsutil.LoadCertPool(cfg.CACert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.Cert != "" || cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
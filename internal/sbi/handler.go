@@ -1,12 +1,26 @@
 package sbi
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/metrics"
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/nfpcf/internal/tracing"
 	"github.com/free5gc/openapi/models"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func (s *Server) handleRegisterNFInstance(w http.ResponseWriter, r *http.Request, nfInstanceID string) {
@@ -27,7 +41,7 @@ func (s *Server) handleRegisterNFInstance(w http.ResponseWriter, r *http.Request
 
 	profile, problemDetails, err := s.processor.GetNRFClient().RegisterNF(r.Context(), &nfProfile)
 	if err != nil {
-		sendProblemDetails(w, http.StatusInternalServerError, "SYSTEM_FAILURE", err.Error())
+		sendNRFError(w, err)
 		return
 	}
 
@@ -37,6 +51,9 @@ func (s *Server) handleRegisterNFInstance(w http.ResponseWriter, r *http.Request
 	}
 
 	if profile != nil {
+		s.processor.GetCache().SetInstanceStatus(profile.NfInstanceId, profile.NfType, profile.NfStatus)
+		s.processor.GetCache().InvalidateNFLists()
+
 		// Add Location header as per TS 29.510
 		w.Header().Set("Location", fmt.Sprintf("/nnrf-nfm/v1/nf-instances/%s", profile.NfInstanceId))
 		sendJSON(w, http.StatusCreated, profile)
@@ -49,7 +66,7 @@ func (s *Server) handleRegisterNFInstance(w http.ResponseWriter, r *http.Request
 func (s *Server) handleGetNFInstance(w http.ResponseWriter, r *http.Request, nfInstanceID string) {
 	profile, problemDetails, err := s.processor.GetNRFClient().GetNFInstance(r.Context(), nfInstanceID)
 	if err != nil {
-		sendProblemDetails(w, http.StatusInternalServerError, "SYSTEM_FAILURE", err.Error())
+		sendNRFError(w, err)
 		return
 	}
 
@@ -66,12 +83,40 @@ func (s *Server) handleGetNFInstance(w http.ResponseWriter, r *http.Request, nfI
 	sendProblemDetails(w, http.StatusNotFound, "CONTEXT_NOT_FOUND", "")
 }
 
+func (s *Server) handleGetNFInstances(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+
+	endLookup := traceCacheLookup(r.Context(), "cache.GetNFList")
+	uriList, found := s.processor.GetCache().GetNFList(queryParams)
+	endLookup(found)
+	if found {
+		logger.SBILog.WithField("query", queryParams.Encode()).Debug("Cache HIT for NF list")
+		sendJSON(w, http.StatusOK, uriList)
+		return
+	}
+
+	logger.SBILog.WithField("query", queryParams.Encode()).Debug("Cache MISS for NF list, querying NRF")
+	uriList, problemDetails, err := s.processor.GetNRFClient().GetNFInstances(r.Context(), queryParams)
+	if err != nil {
+		sendNRFError(w, err)
+		return
+	}
+
+	if problemDetails != nil {
+		sendJSON(w, int(problemDetails.Status), problemDetails)
+		return
+	}
+
+	s.processor.GetCache().SetNFList(queryParams, uriList)
+	sendJSON(w, http.StatusOK, uriList)
+}
+
 func (s *Server) handleDeregisterNFInstance(w http.ResponseWriter, r *http.Request, nfInstanceID string) {
 	s.processor.GetCache().Delete(nfInstanceID)
 
 	problemDetails, err := s.processor.GetNRFClient().DeregisterNF(r.Context(), nfInstanceID)
 	if err != nil {
-		sendProblemDetails(w, http.StatusInternalServerError, "SYSTEM_FAILURE", err.Error())
+		sendNRFError(w, err)
 		return
 	}
 
@@ -80,6 +125,9 @@ func (s *Server) handleDeregisterNFInstance(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	s.processor.GetCache().MarkDeregistered(nfInstanceID)
+	s.processor.GetCache().InvalidateNFLists()
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -94,10 +142,21 @@ func (s *Server) handleUpdateNFInstance(w http.ResponseWriter, r *http.Request,
 
 	profile, err := s.processor.GetNRFClient().UpdateNFInstance(r.Context(), nfInstanceID, patchJSON)
 	if err != nil {
-		sendProblemDetails(w, http.StatusInternalServerError, "SYSTEM_FAILURE", err.Error())
+		sendNRFError(w, err)
 		return
 	}
 
+	// The updated profile, if returned, gives the type of the instance
+	if profile != nil {
+		s.processor.GetCache().SetInstanceStatus(nfInstanceID, profile.NfType, profile.NfStatus)
+	}
+
+	// Heartbeats carry the current load (and status) of the instance
+	var patchItems []models.PatchItem
+	if err := json.Unmarshal(patchJSON, &patchItems); err == nil {
+		s.processor.GetCache().ApplyHeartbeat(nfInstanceID, patchItems)
+	}
+
 	if profile != nil {
 		sendJSON(w, http.StatusOK, profile)
 		return
@@ -112,32 +171,75 @@ func (s *Server) handleDiscoverNFInstances(w http.ResponseWriter, r *http.Reques
 	targetNfType := queryParams.Get("target-nf-type")
 	requesterNfType := queryParams.Get("requester-nf-type")
 
-	// Health check: if no parameters provided, return OK
-	if targetNfType == "" && requesterNfType == "" && len(queryParams) == 0 {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte(`{"status":"healthy"}`))
+	var missing []string
+	if targetNfType == "" {
+		missing = append(missing, "target-nf-type")
+	}
+	if requesterNfType == "" {
+		missing = append(missing, "requester-nf-type")
+	}
+	if len(missing) > 0 {
+		sendProblemDetails(w, http.StatusBadRequest, "MANDATORY_QUERY_PARAM_MISSING",
+			"missing mandatory query parameters: "+strings.Join(missing, ", "))
 		return
 	}
 
-	if targetNfType == "" || requesterNfType == "" {
-		sendProblemDetails(w, http.StatusBadRequest, "Loss mandatory parameter", "")
+	targetPlmns, err := cache.ParsePlmnList(queryParams["target-plmn-list"])
+	if err != nil {
+		sendProblemDetails(w, http.StatusBadRequest, "INVALID_QUERY_PARAM", err.Error())
+		return
+	}
+
+	nrfClient, nrf, err := s.processor.GetPLMNRouter().Route(targetPlmns)
+	if err != nil {
+		sendProblemDetails(w, http.StatusBadRequest, "INVALID_QUERY_PARAM", err.Error())
 		return
 	}
 
 	// Check cache first
-	if cachedResult, found := s.processor.GetCache().GetSearchResult(queryParams); found {
-		fmt.Printf("[NFPCF] Cache HIT for discovery: target=%s, requester=%s\n", targetNfType, requesterNfType)
-		sendJSON(w, http.StatusOK, cachedResult)
+	endLookup := traceCacheLookup(r.Context(), "cache.GetSearchResult")
+	cachedResult, found := s.processor.GetCache().GetSearchResult(queryParams)
+	if !found && queryParams.Get("complex-query") != "" {
+		cachedResult, found = s.processor.GetCache().GetComplexQueryResult(queryParams)
+	}
+	endLookup(found)
+	if found {
+		logger.SBILog.WithFields(logrus.Fields{
+			"target":    targetNfType,
+			"requester": requesterNfType,
+		}).Debug("Cache HIT for discovery")
+		metrics.CacheLookup(targetNfType, metrics.Hit)
+		s.sendCachedSearchResult(w, queryParams, cachedResult)
 		return
 	}
 
-	// Cache miss, query NRF
-	fmt.Printf("[NFPCF] Cache MISS for discovery: target=%s, requester=%s, querying NRF\n", targetNfType, requesterNfType)
-	searchResult, problemDetails, err := s.processor.GetNRFClient().DiscoverNF(r.Context(), queryParams)
+	// Cache miss, query the NRF serving the target PLMN
+	logger.SBILog.WithFields(logrus.Fields{
+		"target":    targetNfType,
+		"requester": requesterNfType,
+		"roaming":   nrf != consumer.HomeNRF,
+	}).Debug("Cache MISS for discovery, querying NRF")
+	searchResult, problemDetails, err := nrfClient.DiscoverNF(r.Context(), queryParams)
 	if err != nil {
-		sendProblemDetails(w, http.StatusInternalServerError, "SYSTEM_FAILURE", err.Error())
+		if errors.Is(err, consumer.ErrNRFUnavailable) {
+			endLookup := traceCacheLookup(r.Context(), "cache.GetStaleSearchResult")
+			staleResult, found := s.processor.GetCache().GetStaleSearchResult(queryParams)
+			endLookup(found)
+			if found {
+				logger.SBILog.WithFields(logrus.Fields{
+					"target":    targetNfType,
+					"requester": requesterNfType,
+				}).Warn("NRF unavailable, serving stale result")
+				metrics.CacheLookup(targetNfType, metrics.Stale)
+				s.sendCachedSearchResult(w, queryParams, staleResult)
+				return
+			}
+		}
+		metrics.CacheLookup(targetNfType, metrics.Miss)
+		sendNRFError(w, err)
 		return
 	}
+	metrics.CacheLookup(targetNfType, metrics.Miss)
 
 	if problemDetails != nil {
 		sendJSON(w, int(problemDetails.Status), problemDetails)
@@ -146,20 +248,330 @@ func (s *Server) handleDiscoverNFInstances(w http.ResponseWriter, r *http.Reques
 
 	if searchResult != nil {
 		// Cache the result
-		s.processor.GetCache().SetSearchResult(queryParams, searchResult)
-		sendJSON(w, http.StatusOK, searchResult)
+		s.processor.GetCache().SetSearchResult(queryParams, nrf, searchResult)
+		sendJSON(w, http.StatusOK, s.processor.GetShaper().Shape(targetNfType, searchResult))
 		return
 	}
 
 	sendProblemDetails(w, http.StatusNotFound, "CONTEXT_NOT_FOUND", "")
 }
 
+// sendCachedSearchResult answers a discovery from a cached result.
+func (s *Server) sendCachedSearchResult(w http.ResponseWriter, queryParams url.Values, result *models.SearchResult) {
+	discoverable := s.processor.GetCache().FilterDiscoverable(result)
+	shaped := s.processor.GetShaper().Shape(queryParams.Get("target-nf-type"), discoverable)
+	sendJSON(w, http.StatusOK, s.limitSearchResult(queryParams, shaped))
+}
+
+// limitSearchResult truncates a cached result to "limit", keeping the rest
+// under an NFPCF-local searchId.
+func (s *Server) limitSearchResult(queryParams url.Values, result *models.SearchResult) *models.SearchResult {
+	limit, err := strconv.Atoi(queryParams.Get("limit"))
+	if err != nil || limit <= 0 || len(result.NfInstances) <= limit {
+		return result
+	}
+
+	searchID, instances, err := s.processor.GetCache().StoreLocalSearch(queryParams, result.NfInstances, limit)
+	if err != nil {
+		logger.SBILog.Errorf("Failed to store local search: %v", err)
+		return result
+	}
+
+	limited := *result
+	limited.NfInstances = instances[:limit]
+	limited.SearchId = searchID
+	limited.NumNfInstComplete = int32(len(instances))
+	return &limited
+}
+
+func (s *Server) handleRetrieveStoredSearch(w http.ResponseWriter, r *http.Request, searchID string, complete bool) {
+	endLookup := traceCacheLookup(r.Context(), "cache.GetStoredSearch")
+	storedSearch, found := s.processor.GetCache().GetStoredSearch(searchID, complete)
+	endLookup(found)
+	if found {
+		logger.SBILog.WithFields(logrus.Fields{
+			"searchId": searchID,
+			"complete": complete,
+		}).Debug("Cache HIT for stored search")
+		sendJSON(w, http.StatusOK, s.processor.GetCache().FilterDiscoverableStoredSearch(storedSearch))
+		return
+	}
+
+	// NFPCF-local searches are unknown to the NRF
+	if strings.HasPrefix(searchID, cache.LocalSearchIDPrefix) {
+		sendProblemDetails(w, http.StatusNotFound, "RESOURCE_URI_STRUCTURE_NOT_FOUND", "")
+		return
+	}
+
+	logger.SBILog.WithFields(logrus.Fields{
+		"searchId": searchID,
+		"complete": complete,
+	}).Debug("Cache MISS for stored search, querying NRF")
+	// Stored searches live at the NRF that returned their searchId
+	nrf, _ := s.processor.GetCache().SearchOrigin(searchID)
+	nrfClient := s.processor.GetPLMNRouter().Client(nrf)
+	storedSearch, problemDetails, err := nrfClient.RetrieveStoredSearch(r.Context(), searchID, complete)
+	if err != nil {
+		sendNRFError(w, err)
+		return
+	}
+
+	if problemDetails != nil {
+		sendJSON(w, int(problemDetails.Status), problemDetails)
+		return
+	}
+
+	if storedSearch != nil {
+		s.processor.GetCache().SetStoredSearch(searchID, complete, storedSearch)
+		sendJSON(w, http.StatusOK, storedSearch)
+		return
+	}
+
+	sendProblemDetails(w, http.StatusNotFound, "CONTEXT_NOT_FOUND", "")
+}
+
+func (s *Server) handleCreateSubscription(w http.ResponseWriter, r *http.Request) {
+	var subscriptionData models.NrfNfManagementSubscriptionData
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendProblemDetails(w, http.StatusBadRequest, "INVALID_MSG_FORMAT", "")
+		return
+	}
+
+	if err := json.Unmarshal(body, &subscriptionData); err != nil {
+		sendProblemDetails(w, http.StatusBadRequest, "INVALID_MSG_FORMAT", "")
+		return
+	}
+
+	if subscriptionData.NfStatusNotificationUri == "" {
+		sendProblemDetails(w, http.StatusBadRequest, "MANDATORY_IE_MISSING", "nfStatusNotificationUri")
+		return
+	}
+
+	var created *models.NrfNfManagementSubscriptionData
+	var problemDetails *models.ProblemDetails
+	if subscriptions := s.processor.GetSubscriptions(); subscriptions != nil {
+		created, problemDetails, err = subscriptions.Subscribe(r.Context(), &subscriptionData)
+	} else {
+		created, problemDetails, err = s.processor.GetNRFClient().CreateSubscription(r.Context(), &subscriptionData)
+	}
+	if err != nil {
+		sendNRFError(w, err)
+		return
+	}
+
+	if problemDetails != nil {
+		sendJSON(w, int(problemDetails.Status), problemDetails)
+		return
+	}
+
+	// Add Location header as per TS 29.510
+	w.Header().Set("Location", fmt.Sprintf("/nnrf-nfm/v1/subscriptions/%s", created.SubscriptionId))
+	sendJSON(w, http.StatusCreated, created)
+}
+
+func (s *Server) handleUpdateSubscription(w http.ResponseWriter, r *http.Request, subscriptionID string) {
+	patchJSON, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendProblemDetails(w, http.StatusBadRequest, "INVALID_MSG_FORMAT", "")
+		return
+	}
+
+	var updated *models.NrfNfManagementSubscriptionData
+	var problemDetails *models.ProblemDetails
+	if subscriptions := s.processor.GetSubscriptions(); subscriptions != nil {
+		var patchItems []models.PatchItem
+		if err := json.Unmarshal(patchJSON, &patchItems); err != nil {
+			sendProblemDetails(w, http.StatusBadRequest, "INVALID_MSG_FORMAT", "")
+			return
+		}
+
+		updated, problemDetails, err = subscriptions.Renew(r.Context(), subscriptionID, patchItems)
+		if err == nil && problemDetails == nil && updated == nil {
+			sendProblemDetails(w, http.StatusNotFound, "SUBSCRIPTION_NOT_FOUND", "")
+			return
+		}
+	} else {
+		updated, problemDetails, err = s.processor.GetNRFClient().UpdateSubscription(r.Context(), subscriptionID, patchJSON)
+	}
+	if err != nil {
+		sendNRFError(w, err)
+		return
+	}
+
+	if problemDetails != nil {
+		sendJSON(w, int(problemDetails.Status), problemDetails)
+		return
+	}
+
+	if updated != nil {
+		sendJSON(w, http.StatusOK, updated)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleRemoveSubscription(w http.ResponseWriter, r *http.Request, subscriptionID string) {
+	if subscriptions := s.processor.GetSubscriptions(); subscriptions != nil {
+		if !subscriptions.Unsubscribe(r.Context(), subscriptionID) {
+			sendProblemDetails(w, http.StatusNotFound, "SUBSCRIPTION_NOT_FOUND", "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	problemDetails, err := s.processor.GetNRFClient().RemoveSubscription(r.Context(), subscriptionID)
+	if err != nil {
+		sendNRFError(w, err)
+		return
+	}
+
+	if problemDetails != nil {
+		sendJSON(w, int(problemDetails.Status), problemDetails)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleNFStatusNotify receives the notifications of the NRF subscriptions
+// NFPCF holds for subscription fan-out.
+func (s *Server) handleNFStatusNotify(w http.ResponseWriter, r *http.Request, upstreamID string) {
+	subscriptions := s.processor.GetSubscriptions()
+	if subscriptions == nil {
+		sendProblemDetails(w, http.StatusNotFound, "RESOURCE_URI_STRUCTURE_NOT_FOUND", "")
+		return
+	}
+
+	var notification models.NrfNfManagementNotificationData
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		sendProblemDetails(w, http.StatusBadRequest, "INVALID_MSG_FORMAT", "")
+		return
+	}
+
+	if err := json.Unmarshal(body, &notification); err != nil {
+		sendProblemDetails(w, http.StatusBadRequest, "INVALID_MSG_FORMAT", "")
+		return
+	}
+
+	if !subscriptions.Notify(upstreamID, &notification) {
+		sendProblemDetails(w, http.StatusNotFound, "SUBSCRIPTION_NOT_FOUND", "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAccessTokenRequest(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") == "" {
+		sendJSON(w, http.StatusBadRequest, models.AccessTokenErr{Error: "invalid_request"})
+		return
+	}
+	form := r.PostForm
+
+	// The form is chosen by the client, so only a verified peer may be
+	// answered from the cache
+	peer, _ := peerIdentity(r)
+	key, cacheable := cache.AccessTokenKey(peer, form)
+	if cacheable {
+		endLookup := traceCacheLookup(r.Context(), "cache.GetAccessToken")
+		tokenRsp, found := s.processor.GetCache().GetAccessToken(key)
+		endLookup(found)
+		if found {
+			logger.SBILog.WithFields(logrus.Fields{
+				"requester": form.Get("nfInstanceId"),
+				"scope":     form.Get("scope"),
+			}).Debug("Cache HIT for access token")
+			sendTokenJSON(w, http.StatusOK, tokenRsp)
+			return
+		}
+	}
+
+	logger.SBILog.WithFields(logrus.Fields{
+		"requester": form.Get("nfInstanceId"),
+		"scope":     form.Get("scope"),
+	}).Debug("Cache MISS for access token, querying NRF")
+	tokenRsp, tokenErr, status, err := s.processor.GetNRFClient().RequestAccessToken(r.Context(), form)
+	if err != nil {
+		sendNRFError(w, err)
+		return
+	}
+
+	if tokenErr != nil {
+		sendTokenJSON(w, status, tokenErr)
+		return
+	}
+
+	if cacheable {
+		s.processor.GetCache().SetAccessToken(key, tokenRsp)
+	}
+	sendTokenJSON(w, http.StatusOK, tokenRsp)
+}
+
+// peerIdentity identifies the client by the fingerprint of its verified TLS
+// certificate.
+func peerIdentity(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	sum := sha256.Sum256(r.TLS.VerifiedChains[0][0].Raw)
+	return hex.EncodeToString(sum[:]), true
+}
+
+// traceCacheLookup starts the span of a cache lookup and returns the function
+// that ends it with the lookup's outcome.
+func traceCacheLookup(ctx context.Context, name string) func(found bool) {
+	_, span := tracing.Tracer().Start(ctx, name)
+
+	return func(found bool) {
+		span.SetAttributes(attribute.Bool("cache.hit", found))
+		span.End()
+	}
+}
+
+// sendTokenJSON sends an access token response, which must not be stored by
+// intermediaries (RFC 6749 clause 5.1).
+func sendTokenJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	sendJSON(w, status, v)
+}
+
+// sendNRFError reports a failed NRF call. Calls rejected by an open circuit
+// breaker get 503 so consumers can fall back to another NRF.
+func sendNRFError(w http.ResponseWriter, err error) {
+	if errors.Is(err, consumer.ErrNRFUnavailable) {
+		sendProblemDetails(w, http.StatusServiceUnavailable, "NRF_UNAVAILABLE", err.Error())
+		return
+	}
+	sendProblemDetails(w, http.StatusInternalServerError, "SYSTEM_FAILURE", err.Error())
+}
+
 func sendJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(v)
 }
 
+// sendOptions answers an OPTIONS request with the methods of the resource.
+func sendOptions(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendMethodNotAllowed rejects a method the resource does not support. TS
+// 29.500 defines no cause for 405, so the generic client error cause is used.
+func sendMethodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	sendProblemDetails(w, http.StatusMethodNotAllowed, "UNSPECIFIED_MSG_FAILURE",
+		fmt.Sprintf("method %s not allowed", r.Method))
+}
+
 func sendProblemDetails(w http.ResponseWriter, status int, cause string, detail string) {
 	pd := models.ProblemDetails{
 		Status: int32(status),
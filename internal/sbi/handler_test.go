@@ -0,0 +1,317 @@
+package sbi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func tokenRequest(peer string) *http.Request {
+	form := url.Values{
+		"grant_type":   {"client_credentials"},
+		"nfInstanceId": {"victim"},
+		"nfType":       {"AMF"},
+		"scope":        {"nsmf-pdusession"},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/oauth2/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if peer != "" {
+		req.TLS = &tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Raw: []byte(peer)}}},
+		}
+	}
+	return req
+}
+
+func TestAccessTokenCacheIsBoundToPeer(t *testing.T) {
+	tests := []struct {
+		name      string
+		first     string
+		second    string
+		wantCalls int64
+	}{
+		{"same verified peer is served from cache", "victim-cert", "victim-cert", 1},
+		{"other verified peer is forwarded", "victim-cert", "attacker-cert", 2},
+		{"unverified peer is forwarded", "victim-cert", "", 2},
+		{"unverified peers are never cached", "", "", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var nrf *stubNRF
+			nrf = newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(models.NrfAccessTokenAccessTokenRsp{
+					AccessToken: fmt.Sprintf("token-%d", nrf.requests.Load()),
+					TokenType:   "Bearer",
+					ExpiresIn:   3600,
+				})
+			})
+			s := newTestServer(t, nrf.URL)
+
+			first := s.serve(tokenRequest(tt.first))
+			second := s.serve(tokenRequest(tt.second))
+			if first.Code != http.StatusOK || second.Code != http.StatusOK {
+				t.Fatalf("status %d, %d", first.Code, second.Code)
+			}
+			if got := nrf.requests.Load(); got != tt.wantCalls {
+				t.Errorf("NRF requests = %d, want %d", got, tt.wantCalls)
+			}
+
+			var firstRsp, secondRsp models.NrfAccessTokenAccessTokenRsp
+			json.Unmarshal(first.Body.Bytes(), &firstRsp)
+			json.Unmarshal(second.Body.Bytes(), &secondRsp)
+			if shared := firstRsp.AccessToken == secondRsp.AccessToken; shared != (tt.wantCalls == 1) {
+				t.Errorf("tokens %q and %q, shared = %v", firstRsp.AccessToken, secondRsp.AccessToken, shared)
+			}
+		})
+	}
+}
+
+func TestDiscoveryComplexQuery(t *testing.T) {
+	nrf := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.SearchResult{NfInstances: []models.NrfNfDiscoveryNfProfile{
+			{NfInstanceId: "smf-1", NfType: "SMF", SmfInfo: &models.SmfInfo{
+				SNssaiSmfInfoList: []models.SnssaiSmfInfoItem{{DnnSmfInfoList: []models.DnnSmfInfoItem{{Dnn: "ims"}}}},
+			}},
+			{NfInstanceId: "smf-2", NfType: "SMF", SmfInfo: &models.SmfInfo{
+				SNssaiSmfInfoList: []models.SnssaiSmfInfoItem{{DnnSmfInfoList: []models.DnnSmfInfoItem{{Dnn: "internet"}}}},
+			}},
+		}})
+	})
+	s := newTestServer(t, nrf.URL)
+
+	discover := func(complexQuery string) models.SearchResult {
+		query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+		if complexQuery != "" {
+			query.Set("complex-query", complexQuery)
+		}
+		rec := s.serve(httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nf-instances?"+query.Encode(), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var result models.SearchResult
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+
+	discover("")
+	tests := []struct {
+		name      string
+		query     string
+		wantCalls int64
+		wantCount int
+	}{
+		{"evaluated from the cached result", `{"cnfUnits":[{"cnfUnit":[{"attr":"dnn","value":"ims","negative":true}]}]}`, 1, 1},
+		{"unsupported attribute goes to the NRF", `{"cnfUnits":[{"cnfUnit":[{"attr":"preferred-locality","value":"x","negative":true}]}]}`, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := discover(tt.query)
+			if got := nrf.requests.Load(); got != tt.wantCalls {
+				t.Errorf("NRF requests = %d, want %d", got, tt.wantCalls)
+			}
+			if len(result.NfInstances) != tt.wantCount {
+				t.Errorf("instances = %d, want %d", len(result.NfInstances), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestStoredSearchIsRetrievedFromOriginNRF(t *testing.T) {
+	searchHandler := func(searchID string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			if strings.HasPrefix(r.URL.Path, "/nnrf-disc/v1/searches/") {
+				if r.URL.Path != "/nnrf-disc/v1/searches/"+searchID {
+					w.WriteHeader(http.StatusNotFound)
+					json.NewEncoder(w).Encode(models.ProblemDetails{Status: http.StatusNotFound, Cause: "RESOURCE_URI_STRUCTURE_NOT_FOUND"})
+					return
+				}
+				json.NewEncoder(w).Encode(models.StoredSearchResult{})
+				return
+			}
+			json.NewEncoder(w).Encode(models.SearchResult{ValidityPeriod: 60, SearchId: searchID})
+		}
+	}
+	home := newStubNRF(t, searchHandler("home-search"))
+	remote := newStubNRF(t, searchHandler("remote-search"))
+
+	tests := []struct {
+		name        string
+		targetPlmns string
+		searchID    string
+		wantHome    int64
+		wantRemote  int64
+	}{
+		{"home discovery", "", "home-search", 2, 0},
+		{"routed discovery", `[{"mcc":"001","mnc":"01"}]`, "remote-search", 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRoutedTestServer(t, home.URL, map[string]string{"001-01": remote.URL})
+			homeBefore, remoteBefore := home.requests.Load(), remote.requests.Load()
+
+			query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+			if tt.targetPlmns != "" {
+				query.Set("target-plmn-list", tt.targetPlmns)
+			}
+			if rec := s.serve(httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nf-instances?"+query.Encode(), nil)); rec.Code != http.StatusOK {
+				t.Fatalf("discovery status %d: %s", rec.Code, rec.Body)
+			}
+			if rec := s.serve(httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/searches/"+tt.searchID, nil)); rec.Code != http.StatusOK {
+				t.Fatalf("stored search status %d: %s", rec.Code, rec.Body)
+			}
+
+			if got := home.requests.Load() - homeBefore; got != tt.wantHome {
+				t.Errorf("home NRF requests = %d, want %d", got, tt.wantHome)
+			}
+			if got := remote.requests.Load() - remoteBefore; got != tt.wantRemote {
+				t.Errorf("remote NRF requests = %d, want %d", got, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestDiscoveryRejectsMixedPlmnList(t *testing.T) {
+	nrf := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.SearchResult{ValidityPeriod: 60})
+	})
+	s := newRoutedTestServer(t, nrf.URL, map[string]string{"001-01": nrf.URL})
+
+	query := url.Values{
+		"target-nf-type":    {"SMF"},
+		"requester-nf-type": {"AMF"},
+		"target-plmn-list":  {`[{"mcc":"208","mnc":"93"},{"mcc":"001","mnc":"01"}]`},
+	}
+	rec := s.serve(httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nf-instances?"+query.Encode(), nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if got := nrf.requests.Load(); got != 0 {
+		t.Errorf("NRF requests = %d, want 0", got)
+	}
+}
+
+func TestLimitedCacheHitsShareLocalSearch(t *testing.T) {
+	nrf := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.SearchResult{
+			ValidityPeriod: 60,
+			NfInstances: []models.NrfNfDiscoveryNfProfile{
+				{NfInstanceId: "smf-1", NfType: "SMF", NfStatus: "REGISTERED"},
+				{NfInstanceId: "smf-2", NfType: "SMF", NfStatus: "REGISTERED"},
+				{NfInstanceId: "smf-3", NfType: "SMF", NfStatus: "REGISTERED"},
+			},
+		})
+	})
+	s := newTestServer(t, nrf.URL)
+
+	discover := func(limit string) models.SearchResult {
+		t.Helper()
+		query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+		if limit != "" {
+			query.Set("limit", limit)
+		}
+		rec := s.serve(httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nf-instances?"+query.Encode(), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+		var result models.SearchResult
+		json.Unmarshal(rec.Body.Bytes(), &result)
+		return result
+	}
+
+	discover("")
+	first := discover("1")
+	second := discover("1")
+	other := discover("2")
+
+	tests := []struct {
+		name   string
+		result models.SearchResult
+		want   int
+		sameID bool
+	}{
+		{"repeated hit", second, 1, true},
+		{"other limit", other, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.result.NfInstances) != tt.want || tt.result.NumNfInstComplete != 3 {
+				t.Errorf("got %d of %d instances, want %d of 3", len(tt.result.NfInstances), tt.result.NumNfInstComplete, tt.want)
+			}
+			if (tt.result.SearchId == first.SearchId) != tt.sameID {
+				t.Errorf("searchId %q, first %q, want same = %v", tt.result.SearchId, first.SearchId, tt.sameID)
+			}
+		})
+	}
+	if got := nrf.requests.Load(); got != 1 {
+		t.Errorf("NRF requests = %d, want 1", got)
+	}
+}
+
+func TestStoredSearchHidesUndiscoverableInstances(t *testing.T) {
+	instances := []models.NrfNfDiscoveryNfProfile{
+		{NfInstanceId: "smf-1", NfType: "SMF", NfStatus: "REGISTERED"},
+		{NfInstanceId: "smf-2", NfType: "SMF", NfStatus: "REGISTERED"},
+		{NfInstanceId: "smf-3", NfType: "SMF", NfStatus: "REGISTERED"},
+	}
+	nrf := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.SearchResult{ValidityPeriod: 60, NfInstances: instances})
+	})
+	s := newTestServer(t, nrf.URL)
+	profileCache := s.processor.GetCache()
+
+	query := url.Values{"target-nf-type": {"SMF"}, "requester-nf-type": {"AMF"}}
+	if rec := s.serve(httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nf-instances?"+query.Encode(), nil)); rec.Code != http.StatusOK {
+		t.Fatalf("discovery status %d: %s", rec.Code, rec.Body)
+	}
+	query.Set("limit", "1")
+	rec := s.serve(httptest.NewRequest(http.MethodGet, "/nnrf-disc/v1/nf-instances?"+query.Encode(), nil))
+	var limited models.SearchResult
+	json.Unmarshal(rec.Body.Bytes(), &limited)
+	if limited.SearchId == "" {
+		t.Fatalf("no local searchId: %s", rec.Body)
+	}
+	profileCache.SetStoredSearch("nrf-search", false, &models.StoredSearchResult{NfInstances: instances})
+
+	profileCache.SetInstanceStatus("smf-2", "SMF", models.NrfNfManagementNfStatus_SUSPENDED)
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{"local search page", "/nnrf-disc/v1/searches/" + limited.SearchId, []string{"smf-3"}},
+		{"complete local search", "/nnrf-disc/v1/searches/" + limited.SearchId + "/complete-stored-search", []string{"smf-1", "smf-3"}},
+		{"NRF stored search", "/nnrf-disc/v1/searches/nrf-search", []string{"smf-1", "smf-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.serve(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var result models.StoredSearchResult
+			json.Unmarshal(rec.Body.Bytes(), &result)
+			var ids []string
+			for _, instance := range result.NfInstances {
+				ids = append(ids, instance.NfInstanceId)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("instances = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
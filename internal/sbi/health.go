@@ -0,0 +1,87 @@
+package sbi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+)
+
+const (
+	statusUp   = "up"
+	statusDown = "down"
+
+	cachePingTimeout = time.Second
+)
+
+type componentStatus struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type nrfStatus struct {
+	Status    string                    `json:"status"`
+	Endpoints []consumer.EndpointStatus `json:"endpoints"`
+}
+
+type readiness struct {
+	Status     string `json:"status"`
+	Components struct {
+		Listener componentStatus `json:"listener"`
+		WarmUp   componentStatus `json:"warmUp"`
+		NRF      nrfStatus       `json:"nrf"`
+		Cache    componentStatus `json:"cache"`
+	} `json:"components"`
+}
+
+// handleHealthz is the liveness probe: answering at all means the process
+// is alive.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, http.StatusOK, componentStatus{Status: statusUp})
+}
+
+// handleReadyz is the readiness probe.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	var ready readiness
+	nrfClient := s.processor.GetNRFClient()
+
+	ready.Components.Listener = componentStatus{Status: statusUp}
+	if s.draining.Load() {
+		ready.Components.Listener = componentStatus{Status: statusDown, Detail: "shutting down"}
+	} else if !s.listening.Load() {
+		ready.Components.Listener = componentStatus{Status: statusDown, Detail: "not listening"}
+	}
+
+	ready.Components.WarmUp = componentStatus{Status: statusUp}
+	if !nrfClient.WarmedUp() {
+		ready.Components.WarmUp = componentStatus{Status: statusDown, Detail: "first NRF health probe pending"}
+	}
+
+	ready.Components.NRF = nrfStatus{Status: statusUp, Endpoints: nrfClient.EndpointStatus()}
+	if !nrfClient.Healthy() {
+		ready.Components.NRF.Status = statusDown
+	}
+
+	ready.Components.Cache = componentStatus{Status: statusUp}
+	if err := s.processor.GetCache().Ping(cachePingTimeout); err != nil {
+		ready.Components.Cache = componentStatus{Status: statusDown, Detail: err.Error()}
+	}
+
+	ready.Status = statusUp
+	for _, status := range []string{
+		ready.Components.Listener.Status,
+		ready.Components.WarmUp.Status,
+		ready.Components.NRF.Status,
+		ready.Components.Cache.Status,
+	} {
+		if status != statusUp {
+			ready.Status = statusDown
+		}
+	}
+
+	if ready.Status != statusUp {
+		sendJSON(w, http.StatusServiceUnavailable, ready)
+		return
+	}
+	sendJSON(w, http.StatusOK, ready)
+}
@@ -2,18 +2,33 @@ package processor
 
 import (
 	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/ordering"
 	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/nfpcf/internal/subscription"
 )
 
 type Processor struct {
-	cache     *cache.NFProfileCache
-	nrfClient *consumer.NRFClient
+	cache      *cache.NFProfileCache
+	nrfClient  *consumer.NRFClient
+	plmnRouter *consumer.PLMNRouter
+	shaper     *ordering.Shaper
+	// subscriptions is nil unless subscription fan-out is enabled
+	subscriptions *subscription.Manager
 }
 
-func NewProcessor(cache *cache.NFProfileCache, nrfClient *consumer.NRFClient) *Processor {
+func NewProcessor(
+	cache *cache.NFProfileCache,
+	nrfClient *consumer.NRFClient,
+	plmnRouter *consumer.PLMNRouter,
+	shaper *ordering.Shaper,
+	subscriptions *subscription.Manager,
+) *Processor {
 	return &Processor{
-		cache:     cache,
-		nrfClient: nrfClient,
+		cache:         cache,
+		nrfClient:     nrfClient,
+		plmnRouter:    plmnRouter,
+		shaper:        shaper,
+		subscriptions: subscriptions,
 	}
 }
 
@@ -24,3 +39,15 @@ func (p *Processor) GetCache() *cache.NFProfileCache {
 func (p *Processor) GetNRFClient() *consumer.NRFClient {
 	return p.nrfClient
 }
+
+func (p *Processor) GetPLMNRouter() *consumer.PLMNRouter {
+	return p.plmnRouter
+}
+
+func (p *Processor) GetShaper() *ordering.Shaper {
+	return p.shaper
+}
+
+func (p *Processor) GetSubscriptions() *subscription.Manager {
+	return p.subscriptions
+}
@@ -1,18 +1,86 @@
 package sbi
 
 import (
-	"fmt"
 	"net/http"
 	"strings"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/metrics"
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/nfpcf/internal/subscription"
+	"github.com/free5gc/nfpcf/internal/tracing"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (s *Server) setupRoutes() {
-	s.mux.HandleFunc("/nnrf-nfm/v1/nf-instances/", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Printf("[NFPCF] %s %s %s from %s\n", r.Proto, r.Method, r.URL.Path, r.RemoteAddr)
+var (
+	nfInstancesMethods = []string{http.MethodGet, http.MethodOptions}
+	nfInstanceMethods  = []string{
+		http.MethodGet, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions,
+	}
+)
+
+// handler wraps the routes with the processing shared by all SBI requests.
+func (s *Server) handler() http.Handler {
+	return metrics.InFlight(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+
+		logger.SBILog.WithFields(logrus.Fields{
+			"proto":  r.Proto,
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"remote": r.RemoteAddr,
+		}).Debug("Request received")
+
+		// Continue the consumer's trace and keep its token and correlation
+		// info in case they are forwarded to the NRF
+		ctx := tracing.Extract(r.Context(), r.Header)
+		ctx = tracing.WithCorrelationInfo(ctx, r.Header.Get(tracing.CorrelationInfoHeader))
+		ctx = consumer.WithConsumerToken(ctx, r.Header.Get("Authorization"))
+
+		_, pattern := s.mux.Handler(r)
+		ctx, span := tracing.Tracer().Start(ctx, r.Method+" "+pattern,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", r.RemoteAddr),
+			))
+		defer span.End()
+		if correlationInfo := r.Header.Get(tracing.CorrelationInfoHeader); correlationInfo != "" {
+			span.SetAttributes(attribute.String("3gpp.sbi.correlation_info", correlationInfo))
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		s.mux.ServeHTTP(recorder, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+		if recorder.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(recorder.status))
+		}
+	}))
+}
+
+// statusRecorder remembers the status code sent by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
 
+func (s *Server) setupRoutes() {
+	s.mux.HandleFunc("/nnrf-nfm/v1/nf-instances/", s.authorize("nnrf-nfm", func(w http.ResponseWriter, r *http.Request) {
+		// nnrf-nfm/v1/nf-instances/{nfInstanceID}
 		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-		if len(pathParts) < 4 {
-			http.Error(w, "Invalid path", http.StatusNotFound)
+		if len(pathParts) != 4 {
+			sendProblemDetails(w, http.StatusNotFound, "RESOURCE_URI_STRUCTURE_NOT_FOUND", "")
 			return
 		}
 
@@ -27,17 +95,116 @@ func (s *Server) setupRoutes() {
 			s.handleDeregisterNFInstance(w, r, nfInstanceID)
 		case http.MethodPatch:
 			s.handleUpdateNFInstance(w, r, nfInstanceID)
+		case http.MethodOptions:
+			sendOptions(w, nfInstanceMethods...)
+		default:
+			sendMethodNotAllowed(w, r, nfInstanceMethods...)
+		}
+	}))
+
+	s.mux.HandleFunc("/nnrf-nfm/v1/nf-instances", s.authorize("nnrf-nfm", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleGetNFInstances(w, r)
+		case http.MethodOptions:
+			sendOptions(w, nfInstancesMethods...)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			sendMethodNotAllowed(w, r, nfInstancesMethods...)
+		}
+	}))
+
+	s.mux.HandleFunc("/nnrf-nfm/v1/subscriptions", s.authorize("nnrf-nfm", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.handleCreateSubscription(w, r)
+		} else {
+			sendMethodNotAllowed(w, r, http.MethodPost)
+		}
+	}))
+
+	s.mux.HandleFunc("/nnrf-nfm/v1/subscriptions/", s.authorize("nnrf-nfm", func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) != 4 {
+			sendProblemDetails(w, http.StatusNotFound, "RESOURCE_URI_STRUCTURE_NOT_FOUND", "")
+			return
+		}
+
+		subscriptionID := pathParts[3]
+
+		switch r.Method {
+		case http.MethodPatch:
+			s.handleUpdateSubscription(w, r, subscriptionID)
+		case http.MethodDelete:
+			s.handleRemoveSubscription(w, r, subscriptionID)
+		default:
+			sendMethodNotAllowed(w, r, http.MethodPatch, http.MethodDelete)
+		}
+	}))
+
+	// Notifications of the NRF subscriptions held for subscription fan-out
+	s.mux.HandleFunc(subscription.NotificationPath, func(w http.ResponseWriter, r *http.Request) {
+		upstreamID := strings.TrimPrefix(r.URL.Path, subscription.NotificationPath)
+		if upstreamID == "" || strings.Contains(upstreamID, "/") {
+			sendProblemDetails(w, http.StatusNotFound, "RESOURCE_URI_STRUCTURE_NOT_FOUND", "")
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			s.handleNFStatusNotify(w, r, upstreamID)
+		} else {
+			sendMethodNotAllowed(w, r, http.MethodPost)
 		}
 	})
 
-	s.mux.HandleFunc("/nnrf-disc/v1/nf-instances", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Printf("[NFPCF] %s %s %s from %s\n", r.Proto, r.Method, r.URL.Path, r.RemoteAddr)
+	s.mux.HandleFunc("/nnrf-disc/v1/nf-instances", s.authorize("nnrf-disc", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			s.handleDiscoverNFInstances(w, r)
 		} else {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			sendMethodNotAllowed(w, r, http.MethodGet)
+		}
+	}))
+
+	s.mux.HandleFunc("/nnrf-disc/v1/searches/", s.authorize("nnrf-disc", func(w http.ResponseWriter, r *http.Request) {
+		// nnrf-disc/v1/searches/{searchId}[/complete-stored-search]
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) < 4 || len(pathParts) > 5 ||
+			(len(pathParts) == 5 && pathParts[4] != "complete-stored-search") {
+			sendProblemDetails(w, http.StatusNotFound, "RESOURCE_URI_STRUCTURE_NOT_FOUND", "")
+			return
 		}
+
+		if r.Method != http.MethodGet {
+			sendMethodNotAllowed(w, r, http.MethodGet)
+			return
+		}
+
+		s.handleRetrieveStoredSearch(w, r, pathParts[3], len(pathParts) == 5)
+	}))
+
+	s.mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			s.handleAccessTokenRequest(w, r)
+		} else {
+			sendMethodNotAllowed(w, r, http.MethodPost)
+		}
+	})
+
+	s.mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			s.handleHealthz(w, r)
+		} else {
+			sendMethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		}
+	})
+
+	s.mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			s.handleReadyz(w, r)
+		} else {
+			sendMethodNotAllowed(w, r, http.MethodGet, http.MethodHead)
+		}
+	})
+
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		sendProblemDetails(w, http.StatusNotFound, "RESOURCE_URI_STRUCTURE_NOT_FOUND", "")
 	})
 }
@@ -0,0 +1,48 @@
+package sbi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/free5gc/openapi/models"
+)
+
+func TestMethodNotAllowed(t *testing.T) {
+	nrf := newStubNRF(t, func(w http.ResponseWriter, r *http.Request) {})
+	s := newTestServer(t, nrf.URL)
+
+	tests := []struct {
+		name      string
+		method    string
+		target    string
+		wantAllow string
+	}{
+		{"nf instance", http.MethodPost, "/nnrf-nfm/v1/nf-instances/amf-1", "GET, PUT, PATCH, DELETE, OPTIONS"},
+		{"subscriptions", http.MethodGet, "/nnrf-nfm/v1/subscriptions", "POST"},
+		{"discovery", http.MethodDelete, "/nnrf-disc/v1/nf-instances", "GET"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := s.serve(httptest.NewRequest(tt.method, tt.target, nil))
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("status = %d, want 405", rec.Code)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+
+			var problem models.ProblemDetails
+			if err := json.NewDecoder(rec.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != http.StatusMethodNotAllowed || problem.Cause != "UNSPECIFIED_MSG_FAILURE" {
+				t.Errorf("ProblemDetails = status %d, cause %q", problem.Status, problem.Cause)
+			}
+			if nrf.requests.Load() != 0 {
+				t.Error("request was forwarded to the NRF")
+			}
+		})
+	}
+}
@@ -1,49 +1,220 @@
 package sbi
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"sync/atomic"
+	"time"
 
+	"github.com/free5gc/nfpcf/internal/logger"
 	"github.com/free5gc/nfpcf/internal/sbi/processor"
+	"github.com/free5gc/nfpcf/internal/tlsutil"
+	"github.com/free5gc/nfpcf/pkg/factory"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 )
 
 type Server struct {
-	httpServer *http.Server
-	mux        *http.ServeMux
-	processor  *processor.Processor
-	bindAddr   string
+	httpServer  *http.Server
+	tlsServer   *http.Server
+	certs       *tlsutil.CertReloader
+	mux         *http.ServeMux
+	processor   *processor.Processor
+	bindAddr    string
+	tlsBindAddr string
+	reload      time.Duration
+	// listening is set once all listeners are bound
+	listening atomic.Bool
+	// draining is set when shutdown begins and fails readiness
+	draining atomic.Bool
+	// inFlight counts the requests being served, including those on h2c
+	// connections, which http.Server.Shutdown does not track
+	inFlight atomic.Int64
+	// tokenValidator is nil unless inbound OAuth2 is enabled
+	tokenValidator *tokenValidator
 }
 
-func NewServer(processor *processor.Processor, bindAddr string) *Server {
+// NewServer creates the SBI server, serving h2c, TLS or both when TLS has
+// its own bind address.
+func NewServer(processor *processor.Processor, serverConfig *factory.Server) (*Server, error) {
 	s := &Server{
 		processor: processor,
-		bindAddr:  bindAddr,
+		bindAddr:  serverConfig.BindAddr,
 		mux:       http.NewServeMux(),
 	}
 
+	if oauth2 := serverConfig.OAuth2; oauth2 != nil && oauth2.Enable {
+		validator, err := newTokenValidator(oauth2)
+		if err != nil {
+			return nil, err
+		}
+		s.tokenValidator = validator
+	}
+
 	s.setupRoutes()
 
-	h2s := &http2.Server{}
-	handler := h2c.NewHandler(s.mux, h2s)
+	tlsConfig := serverConfig.TLS
+	if tlsConfig == nil {
+		s.httpServer = newH2CServer(s.bindAddr, s.handler())
+		return s, nil
+	}
+
+	s.tlsBindAddr = tlsConfig.BindAddr
+	if s.tlsBindAddr == "" {
+		s.tlsBindAddr = s.bindAddr
+	} else {
+		s.httpServer = newH2CServer(s.bindAddr, s.handler())
+	}
 
-	s.httpServer = &http.Server{
+	tlsServer, certs, err := newTLSServer(s.tlsBindAddr, s.handler(), tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	s.tlsServer = tlsServer
+	s.certs = certs
+	s.reload = tlsConfig.ReloadInterval
+
+	return s, nil
+}
+
+func newH2CServer(bindAddr string, handler http.Handler) *http.Server {
+	h2s := &http2.Server{}
+	return &http.Server{
 		Addr:    bindAddr,
-		Handler: handler,
+		Handler: h2c.NewHandler(handler, h2s),
+	}
+}
+
+func newTLSServer(
+	bindAddr string,
+	handler http.Handler,
+	tlsConfig *factory.ServerTLS,
+) (*http.Server, *tlsutil.CertReloader, error) {
+	minVersion, err := tlsutil.ParseVersion(tlsConfig.MinVersion)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server TLS config: %w", err)
+	}
+
+	clientAuth, err := tlsutil.ParseClientAuth(tlsConfig.ClientAuth)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server TLS config: %w", err)
+	}
+
+	certs, err := tlsutil.NewCertReloader(tlsConfig.Cert, tlsConfig.Key, tlsConfig.ClientCA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("server TLS config: %w", err)
+	}
+
+	httpServer := &http.Server{
+		Addr:      bindAddr,
+		Handler:   handler,
+		TLSConfig: certs.ServerConfig(minVersion, clientAuth),
+	}
+
+	if err := http2.ConfigureServer(httpServer, &http2.Server{}); err != nil {
+		return nil, nil, fmt.Errorf("configure HTTP/2: %w", err)
 	}
 
-	return s
+	return httpServer, certs, nil
 }
 
 func (s *Server) Run() error {
-	fmt.Printf("NFPCF server listening on %s (HTTP/2 cleartext)\n", s.bindAddr)
-	return s.httpServer.ListenAndServe()
+	var listener, tlsListener net.Listener
+	if s.httpServer != nil {
+		ln, err := net.Listen("tcp", s.bindAddr)
+		if err != nil {
+			return err
+		}
+		listener = ln
+	}
+	if s.tlsServer != nil {
+		ln, err := net.Listen("tcp", s.tlsBindAddr)
+		if err != nil {
+			if listener != nil {
+				listener.Close()
+			}
+			return err
+		}
+		tlsListener = ln
+	}
+	s.listening.Store(true)
+	defer s.listening.Store(false)
+
+	errCh := make(chan error, 2)
+
+	if listener != nil {
+		logger.SBILog.Infof("NFPCF server listening on %s (HTTP/2 cleartext)", s.bindAddr)
+		go func() {
+			errCh <- s.httpServer.Serve(listener)
+		}()
+	}
+
+	if tlsListener != nil {
+		if s.reload > 0 {
+			go s.certs.Watch(s.reload)
+		}
+
+		logger.SBILog.Infof("NFPCF server listening on %s (HTTP/2 over TLS)", s.tlsBindAddr)
+		go func() {
+			// Certificates come from TLSConfig.GetConfigForClient
+			errCh <- s.tlsServer.ServeTLS(tlsListener, "", "")
+		}()
+	}
+
+	return <-errCh
 }
 
-func (s *Server) Shutdown() error {
-	if s.httpServer != nil {
-		return s.httpServer.Close()
+// drainPollInterval is how often Shutdown checks for in-flight requests.
+const drainPollInterval = 50 * time.Millisecond
+
+// Listening reports whether the listeners are bound.
+func (s *Server) Listening() bool {
+	return s.listening.Load()
+}
+
+// SetDraining makes readiness fail so that traffic is steered away before
+// the listeners close.
+func (s *Server) SetDraining() {
+	s.draining.Store(true)
+}
+
+// Shutdown stops accepting connections and waits until the requests in
+// flight completed or ctx is done; remaining connections are then closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	if s.certs != nil {
+		s.certs.Stop()
+	}
+
+	var err error
+	for _, server := range []*http.Server{s.httpServer, s.tlsServer} {
+		if server == nil {
+			continue
+		}
+		if shutdownErr := server.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for s.inFlight.Load() > 0 && err == nil {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	if err != nil {
+		logger.SBILog.Warnf("Drain incomplete, closing %d in-flight requests: %v", s.inFlight.Load(), err)
+		for _, server := range []*http.Server{s.httpServer, s.tlsServer} {
+			if server != nil {
+				server.Close()
+			}
+		}
 	}
-	return nil
+	return err
 }
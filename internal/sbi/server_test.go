@@ -0,0 +1,96 @@
+package sbi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/ordering"
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/nfpcf/internal/sbi/processor"
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+// stubNRF serves handler over h2c, as the NRF client expects, and counts
+// the requests it received.
+type stubNRF struct {
+	*httptest.Server
+	requests atomic.Int64
+}
+
+func newStubNRF(t *testing.T, handler http.HandlerFunc) *stubNRF {
+	t.Helper()
+	nrf := &stubNRF{}
+	nrf.Server = httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nrf.requests.Add(1)
+		handler(w, r)
+	}), &http2.Server{}))
+	t.Cleanup(nrf.Close)
+	return nrf
+}
+
+func testNRFConfig(url string) *factory.NRF {
+	return &factory.NRF{
+		URL:            url,
+		LoadBalancing:  consumer.PolicyPrimarySecondary,
+		HealthCheck:    &factory.HealthCheck{Path: "/", EjectionTime: time.Second},
+		Timeouts:       &factory.NRFTimeouts{Default: 2 * time.Second},
+		Retry:          &factory.Retry{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 2},
+		CircuitBreaker: &factory.CircuitBreaker{},
+	}
+}
+
+// newTestServer returns an SBI server backed by the NRF at nrfURL.
+func newTestServer(t *testing.T, nrfURL string) *Server {
+	t.Helper()
+	return newRoutedTestServer(t, nrfURL, nil)
+}
+
+// newRoutedTestServer returns an SBI server backed by the home NRF at nrfURL
+// for PLMN 208-93 and by the NRFs of routes for other PLMNs.
+func newRoutedTestServer(t *testing.T, nrfURL string, routes map[string]string) *Server {
+	t.Helper()
+	profileCache := cache.NewNFProfileCache(time.Minute, time.Minute, time.Second)
+	t.Cleanup(profileCache.Stop)
+
+	nrfClient, err := consumer.NewNRFClient([]string{nrfURL}, testNRFConfig(nrfURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nrfClient.Stop)
+
+	shaper, err := ordering.NewShaper(profileCache, "none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routeClients := make(map[string]*consumer.NRFClient, len(routes))
+	for plmn, url := range routes {
+		client, err := consumer.NewNRFClient([]string{url}, testNRFConfig(url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(client.Stop)
+		routeClients[plmn] = client
+	}
+	router := consumer.NewPLMNRouter(nrfClient, []string{"208-93"}, routeClients, nil)
+
+	s, err := NewServer(processor.NewProcessor(profileCache, nrfClient, router, shaper, nil),
+		&factory.Server{BindAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// serve runs req through the server's handler chain.
+func (s *Server) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.handler().ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,544 @@
+package subscription
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/openapi/models"
+)
+
+const (
+	// LocalIDPrefix marks subscriptionIds handed out by NFPCF.
+	LocalIDPrefix = "nfpcf-"
+
+	// NotificationPath is where the NRF delivers notifications, followed by the
+	// upstream subscription's local id.
+	NotificationPath = "/nfpcf-callback/v1/nf-status-notify/"
+
+	cleanupInterval = 30 * time.Second
+	nrfCallTimeout  = 10 * time.Second
+)
+
+// upstream is a subscription NFPCF holds at the NRF on behalf of all local
+// subscribers with the same filter.
+type upstream struct {
+	id                string
+	filter            string
+	nrfSubscriptionID string
+	validity          time.Time
+	subscribers       map[string]*local
+}
+
+// creation is an NRF subscription being created for a filter; subscribers
+// with the same filter wait for it instead of creating their own.
+type creation struct {
+	done           chan struct{}
+	problemDetails *models.ProblemDetails
+	err            error
+}
+
+type local struct {
+	id       string
+	data     models.NrfNfManagementSubscriptionData
+	upstream *upstream
+}
+
+// Manager holds one NRF subscription per distinct filter and fans its
+// notifications out to the local subscribers.
+type Manager struct {
+	nrfClient   *consumer.NRFClient
+	notifier    *consumer.Notifier
+	cache       *cache.NFProfileCache
+	callbackURI string
+	upstreams   map[string]*upstream
+	filters     map[string]*upstream
+	locals      map[string]*local
+	creations   map[string]*creation
+	lock        sync.Mutex
+	ctx         context.Context
+	cancel      context.CancelFunc
+}
+
+// NewManager creates a Manager. callbackURI is the apiRoot under which the
+// NRF reaches NFPCF.
+func NewManager(
+	nrfClient *consumer.NRFClient,
+	notifier *consumer.Notifier,
+	cache *cache.NFProfileCache,
+	callbackURI string,
+) *Manager {
+	m := &Manager{
+		nrfClient:   nrfClient,
+		notifier:    notifier,
+		cache:       cache,
+		callbackURI: strings.TrimSuffix(callbackURI, "/"),
+		upstreams:   make(map[string]*upstream),
+		filters:     make(map[string]*upstream),
+		locals:      make(map[string]*local),
+		creations:   make(map[string]*creation),
+	}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
+	go m.runCleanup()
+
+	return m
+}
+
+// filterKey identifies the subscriptions that receive the same notifications.
+func filterKey(data *models.NrfNfManagementSubscriptionData) (string, error) {
+	filter := *data
+	filter.NfStatusNotificationUri = ""
+	filter.SubscriptionId = ""
+	filter.ValidityTime = nil
+	filter.ReqNfInstanceId = ""
+	filter.ReqNfFqdn = ""
+	filter.RequesterFeatures = ""
+	filter.NrfSupportedFeatures = ""
+
+	key, err := json.Marshal(filter)
+	if err != nil {
+		return "", fmt.Errorf("marshal subscription filter: %w", err)
+	}
+	return string(key), nil
+}
+
+func generateID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate subscriptionId: %w", err)
+	}
+	return LocalIDPrefix + hex.EncodeToString(buf), nil
+}
+
+// Subscribe creates a local subscription, creating the NRF subscription for
+// its filter unless one is already held.
+func (m *Manager) Subscribe(
+	ctx context.Context,
+	data *models.NrfNfManagementSubscriptionData,
+) (*models.NrfNfManagementSubscriptionData, *models.ProblemDetails, error) {
+	key, err := filterKey(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	localID, err := generateID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		up, problemDetails, err := m.upstreamFor(ctx, key, data)
+		if err != nil || problemDetails != nil {
+			return nil, problemDetails, err
+		}
+
+		if data.ValidityTime != nil {
+			m.lock.Lock()
+			renew := !up.validity.IsZero() && data.ValidityTime.After(up.validity)
+			m.lock.Unlock()
+			if renew {
+				if err := m.renewUpstream(ctx, up, *data.ValidityTime); err != nil {
+					// The existing validity still serves the subscriber for a while
+					logger.SubscriptionLog.Warnf("Failed to renew NRF subscription %s: %v", up.nrfSubscriptionID, err)
+				}
+			}
+		}
+
+		m.lock.Lock()
+		if m.upstreams[up.id] != up {
+			// The last subscriber left while the NRF subscription was renewed
+			m.lock.Unlock()
+			continue
+		}
+
+		sub := &local{id: localID, data: *data, upstream: up}
+		sub.data.SubscriptionId = localID
+		sub.data.ValidityTime = grantedValidity(data.ValidityTime, up.validity)
+		up.subscribers[localID] = sub
+		m.locals[localID] = sub
+		subscribers := len(up.subscribers)
+		created := sub.data
+		m.lock.Unlock()
+
+		logger.SubscriptionLog.Debugf("Subscription %s shares NRF subscription %s with %d subscriber(s)",
+			localID, up.nrfSubscriptionID, subscribers)
+
+		return &created, nil, nil
+	}
+}
+
+// upstreamFor returns the upstream subscription for the filter key, creating
+// it at the NRF unless it is held or being created.
+func (m *Manager) upstreamFor(
+	ctx context.Context,
+	key string,
+	data *models.NrfNfManagementSubscriptionData,
+) (*upstream, *models.ProblemDetails, error) {
+	m.lock.Lock()
+	for {
+		if up, exists := m.filters[key]; exists {
+			m.lock.Unlock()
+			return up, nil, nil
+		}
+
+		pending, creating := m.creations[key]
+		if !creating {
+			break
+		}
+
+		m.lock.Unlock()
+		select {
+		case <-pending.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		if pending.err != nil || pending.problemDetails != nil {
+			return nil, pending.problemDetails, pending.err
+		}
+		m.lock.Lock()
+	}
+
+	pending := &creation{done: make(chan struct{})}
+	m.creations[key] = pending
+	m.lock.Unlock()
+
+	up, problemDetails, err := m.createUpstream(ctx, key, data)
+
+	m.lock.Lock()
+	delete(m.creations, key)
+	if up != nil {
+		m.upstreams[up.id] = up
+		m.filters[key] = up
+	}
+	m.lock.Unlock()
+
+	pending.problemDetails, pending.err = problemDetails, err
+	close(pending.done)
+
+	return up, problemDetails, err
+}
+
+func (m *Manager) createUpstream(
+	ctx context.Context,
+	key string,
+	data *models.NrfNfManagementSubscriptionData,
+) (*upstream, *models.ProblemDetails, error) {
+	upstreamID, err := generateID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	request := *data
+	request.SubscriptionId = ""
+	request.NfStatusNotificationUri = m.callbackURI + NotificationPath + upstreamID
+
+	created, problemDetails, err := m.nrfClient.CreateSubscription(ctx, &request)
+	if err != nil || problemDetails != nil {
+		return nil, problemDetails, err
+	}
+
+	up := &upstream{
+		id:                upstreamID,
+		filter:            key,
+		nrfSubscriptionID: created.SubscriptionId,
+		subscribers:       make(map[string]*local),
+	}
+	if created.ValidityTime != nil {
+		up.validity = *created.ValidityTime
+	}
+
+	logger.SubscriptionLog.Infof("Created NRF subscription %s for notifications to %s",
+		up.nrfSubscriptionID, request.NfStatusNotificationUri)
+	return up, nil, nil
+}
+
+// Renew applies a validityTime PATCH. A nil result without problem or error
+// means the subscription does not exist.
+func (m *Manager) Renew(
+	ctx context.Context,
+	subscriptionID string,
+	patch []models.PatchItem,
+) (*models.NrfNfManagementSubscriptionData, *models.ProblemDetails, error) {
+	var requested *time.Time
+	for _, item := range patch {
+		if item.Path != "/validityTime" ||
+			(item.Op != models.PatchOperation_REPLACE && item.Op != models.PatchOperation_ADD) {
+			continue
+		}
+		value, ok := item.Value.(string)
+		if !ok {
+			continue
+		}
+		validity, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			continue
+		}
+		requested = &validity
+	}
+	if requested == nil {
+		return nil, &models.ProblemDetails{
+			Status: 400,
+			Cause:  "MANDATORY_IE_MISSING",
+			Detail: "patch does not replace /validityTime",
+		}, nil
+	}
+
+	m.lock.Lock()
+	sub, exists := m.locals[subscriptionID]
+	if !exists {
+		m.lock.Unlock()
+		return nil, nil, nil
+	}
+	up := sub.upstream
+	renew := !up.validity.IsZero() && requested.After(up.validity)
+	m.lock.Unlock()
+
+	if renew {
+		if err := m.renewUpstream(ctx, up, *requested); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.locals[subscriptionID] != sub {
+		return nil, nil, nil
+	}
+
+	sub.data.ValidityTime = grantedValidity(requested, up.validity)
+
+	renewed := sub.data
+	return &renewed, nil, nil
+}
+
+func (m *Manager) renewUpstream(ctx context.Context, up *upstream, validity time.Time) error {
+	patch, err := json.Marshal([]models.PatchItem{{
+		Op:    models.PatchOperation_REPLACE,
+		Path:  "/validityTime",
+		Value: validity.UTC().Format(time.RFC3339),
+	}})
+	if err != nil {
+		return fmt.Errorf("marshal patch: %w", err)
+	}
+
+	updated, problemDetails, err := m.nrfClient.UpdateSubscription(ctx, up.nrfSubscriptionID, patch)
+	if err != nil {
+		return err
+	}
+	if problemDetails != nil {
+		return fmt.Errorf("NRF rejected renewal: %s", problemDetails.Cause)
+	}
+
+	if updated != nil && updated.ValidityTime != nil {
+		validity = *updated.ValidityTime
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// A concurrent renewal may have been granted a later validity
+	if validity.After(up.validity) {
+		up.validity = validity
+	}
+	return nil
+}
+
+// grantedValidity bounds the validity requested by a subscriber by the one
+// granted by the NRF; a zero granted validity means the NRF set no limit.
+func grantedValidity(requested *time.Time, granted time.Time) *time.Time {
+	if granted.IsZero() {
+		return requested
+	}
+	if requested != nil && requested.Before(granted) {
+		return requested
+	}
+	validity := granted
+	return &validity
+}
+
+// Unsubscribe removes a local subscription and reports whether it existed.
+// The NRF subscription is removed with its last subscriber.
+func (m *Manager) Unsubscribe(ctx context.Context, subscriptionID string) bool {
+	m.lock.Lock()
+	sub, exists := m.locals[subscriptionID]
+	var orphan *upstream
+	if exists {
+		orphan = m.removeLocalLocked(sub)
+	}
+	m.lock.Unlock()
+
+	if orphan != nil {
+		m.removeUpstream(ctx, orphan)
+	}
+	return exists
+}
+
+// removeLocalLocked forgets a local subscription and returns its upstream
+// subscription if it was the last subscriber, for removal at the NRF.
+func (m *Manager) removeLocalLocked(sub *local) *upstream {
+	delete(m.locals, sub.id)
+
+	up := sub.upstream
+	delete(up.subscribers, sub.id)
+	if len(up.subscribers) > 0 {
+		return nil
+	}
+
+	delete(m.upstreams, up.id)
+	delete(m.filters, up.filter)
+	return up
+}
+
+func (m *Manager) removeUpstream(ctx context.Context, up *upstream) {
+	problemDetails, err := m.nrfClient.RemoveSubscription(ctx, up.nrfSubscriptionID)
+	if err != nil {
+		// The NRF drops the subscription when its validity ends
+		logger.SubscriptionLog.Warnf("Failed to remove NRF subscription %s: %v", up.nrfSubscriptionID, err)
+		return
+	}
+	if problemDetails != nil {
+		logger.SubscriptionLog.Warnf("NRF rejected removal of subscription %s: %s", up.nrfSubscriptionID, problemDetails.Cause)
+		return
+	}
+
+	logger.SubscriptionLog.Infof("Removed NRF subscription %s", up.nrfSubscriptionID)
+}
+
+// Notify handles an NFStatusNotify for upstreamID and reports whether the
+// subscription is known.
+func (m *Manager) Notify(upstreamID string, notification *models.NrfNfManagementNotificationData) bool {
+	m.lock.Lock()
+	up, exists := m.upstreams[upstreamID]
+	var uris []string
+	if exists {
+		now := time.Now()
+		for _, sub := range up.subscribers {
+			if sub.data.ValidityTime == nil || sub.data.ValidityTime.After(now) {
+				uris = append(uris, sub.data.NfStatusNotificationUri)
+			}
+		}
+	}
+	m.lock.Unlock()
+
+	if !exists {
+		return false
+	}
+
+	m.applyToCache(notification)
+
+	for _, uri := range uris {
+		go func(uri string) {
+			if err := m.notifier.NotifyNFStatus(m.ctx, uri, notification); err != nil {
+				logger.SubscriptionLog.Warnf("Failed to notify %s of %s: %v", uri, notification.Event, err)
+			}
+		}(uri)
+	}
+
+	return true
+}
+
+// applyToCache keeps the instance states of the cache in line with the
+// notified NF status changes.
+func (m *Manager) applyToCache(notification *models.NrfNfManagementNotificationData) {
+	nfInstanceID := path.Base(notification.NfInstanceUri)
+	if notification.NfProfile != nil && notification.NfProfile.NfInstanceId != "" {
+		nfInstanceID = notification.NfProfile.NfInstanceId
+	}
+	if nfInstanceID == "" || nfInstanceID == "." || nfInstanceID == "/" {
+		return
+	}
+
+	if notification.Event != models.NotificationEventType_PROFILE_CHANGED {
+		m.cache.InvalidateNFLists()
+	}
+
+	switch notification.Event {
+	case models.NotificationEventType_DEREGISTERED:
+		m.cache.Delete(nfInstanceID)
+		m.cache.MarkDeregistered(nfInstanceID)
+	case models.NotificationEventType_REGISTERED, models.NotificationEventType_PROFILE_CHANGED:
+		m.cache.Delete(nfInstanceID)
+		if profile := notification.NfProfile; profile != nil {
+			m.cache.SetInstanceStatus(nfInstanceID, profile.NfType, profile.NfStatus)
+		}
+	}
+}
+
+func (m *Manager) runCleanup() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.cleanupExpired()
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *Manager) cleanupExpired() {
+	var orphans []*upstream
+
+	m.lock.Lock()
+	now := time.Now()
+	for _, sub := range m.locals {
+		if sub.data.ValidityTime != nil && !sub.data.ValidityTime.After(now) {
+			logger.SubscriptionLog.Infof("Subscription %s expired", sub.id)
+			if up := m.removeLocalLocked(sub); up != nil {
+				orphans = append(orphans, up)
+			}
+		}
+	}
+	m.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(m.ctx, nrfCallTimeout)
+	defer cancel()
+
+	for _, up := range orphans {
+		m.removeUpstream(ctx, up)
+	}
+}
+
+// RemoveAll removes every subscription NFPCF holds at the NRF.
+func (m *Manager) RemoveAll(ctx context.Context) {
+	m.lock.Lock()
+	upstreams := make([]*upstream, 0, len(m.upstreams))
+	for _, up := range m.upstreams {
+		upstreams = append(upstreams, up)
+	}
+	locals := len(m.locals)
+	clear(m.upstreams)
+	clear(m.filters)
+	clear(m.locals)
+	m.lock.Unlock()
+
+	for _, up := range upstreams {
+		problemDetails, err := m.nrfClient.RemoveSubscription(ctx, up.nrfSubscriptionID)
+		if err != nil {
+			logger.SubscriptionLog.Warnf("Failed to remove NRF subscription %s: %v", up.nrfSubscriptionID, err)
+		} else if problemDetails != nil {
+			logger.SubscriptionLog.Warnf("NRF rejected removal of subscription %s: %s", up.nrfSubscriptionID, problemDetails.Cause)
+		}
+	}
+
+	logger.SubscriptionLog.Infof("Removed %d NRF subscriptions of %d local subscriptions", len(upstreams), locals)
+}
+
+// Stop ends the cleanup of expired subscriptions and cancels the deliveries
+// of notifications in progress.
+func (m *Manager) Stop() {
+	m.cancel()
+}
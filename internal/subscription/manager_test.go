@@ -0,0 +1,245 @@
+package subscription
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/nfpcf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+// stubNRF creates subscriptions over h2c, holding the creations after the
+// first held ones until release is closed, and records the callback URIs it
+// was given.
+type stubNRF struct {
+	*httptest.Server
+	held      int64
+	release   chan struct{}
+	creations atomic.Int64
+	lock      sync.Mutex
+	callbacks []string
+}
+
+func newStubNRF(t *testing.T, held int64) *stubNRF {
+	t.Helper()
+	nrf := &stubNRF{held: held, release: make(chan struct{})}
+	nrf.Server = httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var data models.NrfNfManagementSubscriptionData
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := nrf.creations.Add(1)
+		nrf.lock.Lock()
+		nrf.callbacks = append(nrf.callbacks, data.NfStatusNotificationUri)
+		nrf.lock.Unlock()
+
+		if n > nrf.held {
+			<-nrf.release
+		}
+		data.SubscriptionId = fmt.Sprintf("nrf-%d", n)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(data)
+	}), &http2.Server{}))
+	t.Cleanup(nrf.Close)
+	return nrf
+}
+
+// upstreamID returns the local id of the i-th upstream subscription created
+// at the stub.
+func (nrf *stubNRF) upstreamID(i int) string {
+	nrf.lock.Lock()
+	defer nrf.lock.Unlock()
+	return nrf.callbacks[i][strings.LastIndex(nrf.callbacks[i], "/")+1:]
+}
+
+func newTestManager(t *testing.T, nrfURL string) *Manager {
+	t.Helper()
+	nrfConfig := &factory.NRF{
+		URL:            nrfURL,
+		LoadBalancing:  consumer.PolicyPrimarySecondary,
+		HealthCheck:    &factory.HealthCheck{Path: "/", EjectionTime: time.Second},
+		Timeouts:       &factory.NRFTimeouts{Default: 5 * time.Second},
+		Retry:          &factory.Retry{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 2},
+		CircuitBreaker: &factory.CircuitBreaker{},
+	}
+	nrfClient, err := consumer.NewNRFClient([]string{nrfURL}, nrfConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nrfClient.Stop)
+
+	notifier, err := consumer.NewNotifier(nil, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profileCache := cache.NewNFProfileCache(time.Minute, time.Minute, time.Second)
+	t.Cleanup(profileCache.Stop)
+
+	m := NewManager(nrfClient, notifier, profileCache, "http://nfpcf.example")
+	t.Cleanup(m.Stop)
+	return m
+}
+
+func subscriptionData(nfType, callback string) *models.NrfNfManagementSubscriptionData {
+	return &models.NrfNfManagementSubscriptionData{
+		NfStatusNotificationUri: callback,
+		SubscrCond:              &models.SubscrCond{NfType: nfType},
+	}
+}
+
+func TestSubscribeSharesUpstreamCreation(t *testing.T) {
+	tests := []struct {
+		name          string
+		nfTypes       []string
+		wantCreations int64
+	}{
+		{
+			name:          "same filter",
+			nfTypes:       []string{"SMF", "SMF", "SMF", "SMF"},
+			wantCreations: 1,
+		},
+		{
+			name:          "distinct filters",
+			nfTypes:       []string{"SMF", "AMF", "SMF", "AMF"},
+			wantCreations: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrf := newStubNRF(t, 0)
+			m := newTestManager(t, nrf.URL)
+
+			var wg sync.WaitGroup
+			errs := make(chan error, len(tt.nfTypes))
+			for i, nfType := range tt.nfTypes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					data := subscriptionData(nfType, fmt.Sprintf("http://nf%d.example/notify", i))
+					_, problemDetails, err := m.Subscribe(context.Background(), data)
+					if err == nil && problemDetails != nil {
+						err = fmt.Errorf("problem: %s", problemDetails.Cause)
+					}
+					errs <- err
+				}()
+			}
+
+			// Let every subscriber reach the NRF or the pending creation
+			time.Sleep(100 * time.Millisecond)
+			close(nrf.release)
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := nrf.creations.Load(); got != tt.wantCreations {
+				t.Errorf("NRF creations = %d, want %d", got, tt.wantCreations)
+			}
+			if got := len(m.locals); got != len(tt.nfTypes) {
+				t.Errorf("local subscriptions = %d, want %d", got, len(tt.nfTypes))
+			}
+		})
+	}
+}
+
+func TestNotifyDuringNRFCall(t *testing.T) {
+	// The first creation completes, the second stays at the NRF
+	nrf := newStubNRF(t, 1)
+	defer close(nrf.release)
+	m := newTestManager(t, nrf.URL)
+
+	delivered := make(chan struct{}, 1)
+	callback := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		delivered <- struct{}{}
+	}), &http2.Server{}))
+	defer callback.Close()
+
+	if _, _, err := m.Subscribe(context.Background(), subscriptionData("SMF", callback.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		_, _, _ = m.Subscribe(context.Background(), subscriptionData("AMF", "http://amf.example/notify"))
+	}()
+	for nrf.creations.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	notified := make(chan bool)
+	go func() {
+		notified <- m.Notify(nrf.upstreamID(0), &models.NrfNfManagementNotificationData{
+			Event:         models.NotificationEventType_PROFILE_CHANGED,
+			NfInstanceUri: "http://nrf.example/nnrf-nfm/v1/nf-instances/smf-1",
+		})
+	}()
+
+	select {
+	case known := <-notified:
+		if !known {
+			t.Fatal("Notify did not know the upstream subscription")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Notify waited for the NRF call of another subscription")
+	}
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("notification was not delivered")
+	}
+}
+
+func TestStopCancelsNotifications(t *testing.T) {
+	nrf := newStubNRF(t, 1)
+	m := newTestManager(t, nrf.URL)
+
+	cancelled := make(chan struct{})
+	callback := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}), &http2.Server{}))
+	defer callback.Close()
+
+	if _, _, err := m.Subscribe(context.Background(), subscriptionData("SMF", callback.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Notify(nrf.upstreamID(0), &models.NrfNfManagementNotificationData{
+		Event:         models.NotificationEventType_PROFILE_CHANGED,
+		NfInstanceUri: "http://nrf.example/nnrf-nfm/v1/nf-instances/smf-1",
+	})
+	time.Sleep(50 * time.Millisecond)
+	m.Stop()
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop did not cancel the notification in progress")
+	}
+}
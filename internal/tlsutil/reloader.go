@@ -0,0 +1,143 @@
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+)
+
+// CertReloader serves a certificate and client CA bundle reloaded from disk.
+type CertReloader struct {
+	certFile  string
+	keyFile   string
+	caFile    string
+	cert      atomic.Pointer[tls.Certificate]
+	clientCAs atomic.Pointer[x509.CertPool]
+	modTimes  map[string]time.Time
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+}
+
+func NewCertReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		modTimes: make(map[string]time.Time),
+		stopCh:   make(chan struct{}),
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.modTimes = r.currentModTimes()
+
+	return r, nil
+}
+
+func (r *CertReloader) load() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pool, err = LoadCertPool(r.caFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	r.cert.Store(&cert)
+	r.clientCAs.Store(pool)
+	return nil
+}
+
+func (r *CertReloader) currentModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[file] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// Watch polls the files every interval and reloads them when one of them
+// changed. A reload that fails keeps the previous certificate.
+func (r *CertReloader) Watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			modTimes := r.currentModTimes()
+			changed := len(modTimes) != len(r.modTimes)
+			for file, modTime := range modTimes {
+				if !r.modTimes[file].Equal(modTime) {
+					changed = true
+				}
+			}
+			if !changed {
+				continue
+			}
+
+			if err := r.load(); err != nil {
+				logger.TLSLog.Errorf("TLS certificate reload failed, keeping previous: %v", err)
+				continue
+			}
+			r.modTimes = modTimes
+			logger.TLSLog.Infof("TLS certificate reloaded from %s", r.certFile)
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+func (r *CertReloader) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.cert.Load(), nil
+}
+
+// ClientCAs returns the current client CA pool, nil if none is configured.
+func (r *CertReloader) ClientCAs() *x509.CertPool {
+	return r.clientCAs.Load()
+}
+
+// ServerConfig returns a server TLS configuration whose handshakes always
+// pick up the latest certificate and client CAs.
+func (r *CertReloader) ServerConfig(minVersion uint16, clientAuth tls.ClientAuthType) *tls.Config {
+	baseConfig := &tls.Config{
+		MinVersion: minVersion,
+		ClientAuth: clientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: r.GetCertificate,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := baseConfig.Clone()
+			cfg.GetCertificate = r.GetCertificate
+			cfg.ClientCAs = r.ClientCAs()
+			return cfg, nil
+		},
+	}
+}
@@ -0,0 +1,176 @@
+package tlsutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a new self-signed certificate for commonName and its key
+// to certFile and keyFile, and returns the DER certificate.
+func writeCert(t *testing.T, certFile, keyFile, commonName string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{"", tls.VersionTLS12, false},
+		{"1.2", tls.VersionTLS12, false},
+		{"1.3", tls.VersionTLS13, false},
+		{"1.1", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ParseVersion(tt.version)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ParseVersion() = %d, %v, want %d, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseClientAuth(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    tls.ClientAuthType
+		wantErr bool
+	}{
+		{"", tls.NoClientCert, false},
+		{"none", tls.NoClientCert, false},
+		{"request", tls.RequestClientCert, false},
+		{"require", tls.RequireAnyClientCert, false},
+		{"verify-if-given", tls.VerifyClientCertIfGiven, false},
+		{"require-and-verify", tls.RequireAndVerifyClientCert, false},
+		{"always", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := ParseClientAuth(tt.mode)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ParseClientAuth() = %v, %v, want %v, wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadCertPool(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeCert(t, caFile, filepath.Join(dir, "ca.key"), "ca")
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr bool
+	}{
+		{"bundle", caFile, false},
+		{"no certificates", notPEM, true},
+		{"missing file", filepath.Join(dir, "missing.pem"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadCertPool(tt.path); (err != nil) != tt.wantErr {
+				t.Errorf("LoadCertPool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.pem")
+	keyFile := filepath.Join(dir, "server.key")
+	first := writeCert(t, certFile, keyFile, "first")
+
+	r, err := NewCertReloader(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	go r.Watch(10 * time.Millisecond)
+
+	current := func() []byte {
+		cert, _ := r.GetCertificate(nil)
+		return cert.Certificate[0]
+	}
+	if !bytes.Equal(current(), first) {
+		t.Fatal("initial certificate not served")
+	}
+	if r.ClientCAs() != nil {
+		t.Error("client CAs without a CA file")
+	}
+
+	// A broken key keeps the previous certificate
+	later := time.Now().Add(time.Second)
+	if err := os.WriteFile(keyFile, []byte("broken"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if !bytes.Equal(current(), first) {
+		t.Fatal("failed reload replaced the certificate")
+	}
+
+	second := writeCert(t, certFile, keyFile, "second")
+	later = later.Add(time.Second)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !bytes.Equal(current(), second) {
+		if time.Now().After(deadline) {
+			t.Fatal("changed certificate was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
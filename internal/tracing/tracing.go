@@ -0,0 +1,124 @@
+// Package tracing sets up OpenTelemetry tracing and trace context propagation.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/free5gc/nfpcf"
+
+// CorrelationInfoHeader is the 3GPP header (TS 29.500) correlating SBI
+// messages of the same UE or session.
+const CorrelationInfoHeader = "3gpp-Sbi-Correlation-Info"
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+}
+
+// Tracer returns the tracer used for all NFPCF spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// Init installs the tracer provider configured in config and returns its
+// shutdown function.
+func Init(config *factory.Tracing, version string) (func(context.Context) error, error) {
+	if config == nil || !config.Enable {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, closeOutput, err := newExporter(config)
+	if err != nil {
+		return nil, fmt.Errorf("tracing config: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", config.ServiceName),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closeOutput != nil {
+			closeOutput.Close()
+		}
+		return err
+	}, nil
+}
+
+func newExporter(config *factory.Tracing) (sdktrace.SpanExporter, io.Closer, error) {
+	switch config.Exporter {
+	case "otlp":
+		exporter, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(config.Endpoint))
+		if err != nil {
+			return nil, nil, fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		return exporter, nil, nil
+	case "stdout":
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, nil, fmt.Errorf("create stdout exporter: %w", err)
+		}
+		return exporter, nil, nil
+	case "file":
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("create file exporter: %w", err)
+		}
+		return exporter, file, nil
+	}
+	return nil, nil, fmt.Errorf("unknown exporter %q (want otlp, stdout or file)", config.Exporter)
+}
+
+type correlationInfoKey struct{}
+
+// WithCorrelationInfo keeps the 3gpp-Sbi-Correlation-Info header of an
+// inbound request for the NRF requests made on its behalf.
+func WithCorrelationInfo(ctx context.Context, correlationInfo string) context.Context {
+	if correlationInfo == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationInfoKey{}, correlationInfo)
+}
+
+// Inject adds the trace context and the correlation info of ctx to the
+// headers of an outgoing request.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	if correlationInfo, ok := ctx.Value(correlationInfoKey{}).(string); ok {
+		header.Set(CorrelationInfoHeader, correlationInfo)
+	}
+}
+
+// Extract returns ctx with the trace context of inbound request headers.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
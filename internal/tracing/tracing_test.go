@@ -0,0 +1,95 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestPropagation(t *testing.T) {
+	tests := []struct {
+		name            string
+		inbound         http.Header
+		correlationInfo string
+		want            http.Header
+	}{
+		{
+			name: "nothing to forward",
+			want: http.Header{},
+		},
+		{
+			name:    "trace context",
+			inbound: http.Header{"Traceparent": {traceparent}},
+			want:    http.Header{"Traceparent": {traceparent}},
+		},
+		{
+			name:            "correlation info",
+			correlationInfo: "imsi-208930000000001",
+			want:            http.Header{"3gpp-Sbi-Correlation-Info": {"imsi-208930000000001"}},
+		},
+		{
+			name:            "both with baggage",
+			inbound:         http.Header{"Traceparent": {traceparent}, "Baggage": {"tenant=a"}},
+			correlationInfo: "imsi-208930000000001",
+			want: http.Header{
+				"Traceparent":               {traceparent},
+				"Baggage":                   {"tenant=a"},
+				"3gpp-Sbi-Correlation-Info": {"imsi-208930000000001"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := Extract(context.Background(), tt.inbound)
+			ctx = WithCorrelationInfo(ctx, tt.correlationInfo)
+
+			got := http.Header{}
+			Inject(ctx, got)
+			for name := range tt.want {
+				if got.Get(name) != tt.want.Get(name) {
+					t.Errorf("%s = %q, want %q", name, got.Get(name), tt.want.Get(name))
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("headers = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *factory.Tracing
+		wantErr bool
+	}{
+		{name: "no config", config: nil},
+		{name: "disabled", config: &factory.Tracing{Exporter: "unknown"}},
+		{name: "stdout", config: &factory.Tracing{Enable: true, Exporter: "stdout", SampleRatio: 1}},
+		{name: "file", config: &factory.Tracing{
+			Enable: true, Exporter: "file", File: filepath.Join(t.TempDir(), "traces.json"), SampleRatio: 1,
+		}},
+		{name: "unwritable file", config: &factory.Tracing{
+			Enable: true, Exporter: "file", File: filepath.Join(t.TempDir(), "missing", "traces.json"),
+		}, wantErr: true},
+		{name: "unknown exporter", config: &factory.Tracing{Enable: true, Exporter: "zipkin"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Init(tt.config, "test")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if err := shutdown(context.Background()); err != nil {
+					t.Errorf("shutdown() error = %v", err)
+				}
+			}
+		})
+	}
+}
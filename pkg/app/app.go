@@ -2,15 +2,25 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/free5gc/nfpcf/internal/admin"
 	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/metrics"
+	"github.com/free5gc/nfpcf/internal/ordering"
 	"github.com/free5gc/nfpcf/internal/sbi"
 	"github.com/free5gc/nfpcf/internal/sbi/consumer"
 	"github.com/free5gc/nfpcf/internal/sbi/processor"
+	"github.com/free5gc/nfpcf/internal/subscription"
+	"github.com/free5gc/nfpcf/internal/tracing"
 	"github.com/free5gc/nfpcf/pkg/factory"
 )
 
@@ -19,68 +29,374 @@ type App struct {
 	cache     *cache.NFProfileCache
 	processor *processor.Processor
 	server    *sbi.Server
-	ctx       context.Context
-	cancel    context.CancelFunc
+	// metricsServer is nil unless metrics are enabled
+	metricsServer *http.Server
+	// adminServer is nil unless the admin API is enabled
+	adminServer     *admin.Server
+	tracingShutdown func(context.Context) error
+	ctx             context.Context
+	cancel          context.CancelFunc
+	stopOnce        sync.Once
+	// stopped is closed once Stop completed
+	stopped chan struct{}
+	// source is nil when the configuration cannot be reloaded
+	source     *ConfigSource
+	reloadLock sync.Mutex
 }
 
-func NewApp(config *factory.Config) (*App, error) {
+// subscriptionRemovalTimeout bounds the removal of the NRF subscriptions on
+// shutdown.
+const subscriptionRemovalTimeout = 10 * time.Second
+
+// NewApp creates NFPCF from config, which becomes the effective
+// configuration. source is used to reload it and may be nil.
+func NewApp(config *factory.Config, source *ConfigSource) (*App, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := logger.SetLevel(config.Logger.Level); err != nil {
+		return nil, fmt.Errorf("logger config: %w", err)
+	}
+	if err := logger.SetFormat(config.Logger.Format); err != nil {
+		return nil, fmt.Errorf("logger config: %w", err)
+	}
+
+	tracingShutdown, err := tracing.Init(config.Tracing, config.Info.Version)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 
 	app := &App{
-		config: config,
-		ctx:    ctx,
-		cancel: cancel,
+		config:          config,
+		tracingShutdown: tracingShutdown,
+		ctx:             ctx,
+		cancel:          cancel,
+		stopped:         make(chan struct{}),
+		source:          source,
+	}
+	factory.SetNfpcfConfig(config)
+
+	app.cache = cache.NewNFProfileCache(config.Cache.TTL, config.Cache.StaleTTL, config.Cache.TokenExpiryMargin)
+	if err := app.cache.SetTTLPolicies(ttlPolicies(config.Cache)); err != nil {
+		cancel()
+		app.cache.Stop()
+		return nil, fmt.Errorf("cache config: %w", err)
+	}
+	if file := config.Cache.SnapshotFile; file != "" {
+		// A missing or unreadable snapshot only means a cold cache
+		if restored, err := app.cache.LoadSnapshot(file); err != nil {
+			logger.MainLog.Warnf("Failed to restore cache snapshot: %v", err)
+		} else if restored > 0 {
+			logger.MainLog.Infof("Restored %d cache entries from %s", restored, file)
+		}
+	}
+
+	shaper, err := ordering.NewShaper(app.cache, config.Ordering.DefaultPolicy, config.Ordering.NfTypePolicies)
+	if err != nil {
+		cancel()
+		app.cache.Stop()
+		return nil, fmt.Errorf("ordering config: %w", err)
+	}
+
+	nrfClient, err := consumer.NewNRFClient(config.NRF.HomeEndpoints(), config.NRF)
+	if err != nil {
+		cancel()
+		app.cache.Stop()
+		return nil, err
+	}
+
+	plmnRouter, err := newPLMNRouter(config.NRF, nrfClient)
+	if err != nil {
+		cancel()
+		app.cache.Stop()
+		nrfClient.Stop()
+		return nil, err
+	}
+
+	subscriptions, err := newSubscriptionManager(config, nrfClient, app.cache)
+	if err != nil {
+		cancel()
+		app.cache.Stop()
+		plmnRouter.Stop()
+		return nil, err
 	}
 
-	app.cache = cache.NewNFProfileCache(config.Cache.TTL)
+	app.processor = processor.NewProcessor(app.cache, nrfClient, plmnRouter, shaper, subscriptions)
 
-	nrfClient := consumer.NewNRFClient(config.NRF.URL)
+	app.server, err = sbi.NewServer(app.processor, config.Server)
+	if err != nil {
+		cancel()
+		app.cache.Stop()
+		plmnRouter.Stop()
+		if subscriptions != nil {
+			subscriptions.Stop()
+		}
+		return nil, err
+	}
 
-	app.processor = processor.NewProcessor(app.cache, nrfClient)
+	if config.Metrics.Enable {
+		if err := metrics.Register(metrics.NewCacheCollector(app.cache)); err != nil {
+			app.Stop()
+			return nil, fmt.Errorf("register cache metrics: %w", err)
+		}
+		app.metricsServer = newMetricsServer(config.Metrics.BindAddr)
+	}
 
-	app.server = sbi.NewServer(app.processor, config.Server.BindAddr)
+	if config.Admin.Enable {
+		app.adminServer, err = admin.NewServer(app.cache, config.Admin)
+		if err != nil {
+			app.Stop()
+			return nil, err
+		}
+	}
 
 	return app, nil
 }
 
+func newMetricsServer(bindAddr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	return &http.Server{
+		Addr:    bindAddr,
+		Handler: mux,
+	}
+}
+
+func newPLMNRouter(nrfConfig *factory.NRF, home *consumer.NRFClient) (*consumer.PLMNRouter, error) {
+	homePlmns := make([]string, 0, len(nrfConfig.HomePlmnList))
+	for _, plmn := range nrfConfig.HomePlmnList {
+		homePlmns = append(homePlmns, plmn.Mcc+"-"+plmn.Mnc)
+	}
+
+	var clients []*consumer.NRFClient
+	stopAll := func() {
+		for _, client := range clients {
+			client.Stop()
+		}
+	}
+
+	routes := make(map[string]*consumer.NRFClient, len(nrfConfig.PlmnRoutes))
+	for _, route := range nrfConfig.PlmnRoutes {
+		client, err := consumer.NewNRFClient([]string{route.URL}, remoteNRFConfig(nrfConfig, route.TLS))
+		if err != nil {
+			stopAll()
+			return nil, err
+		}
+		clients = append(clients, client)
+		routes[route.Plmn.Mcc+"-"+route.Plmn.Mnc] = client
+	}
+
+	var roaming *consumer.NRFClient
+	if nrfConfig.RoamingURL != "" {
+		client, err := consumer.NewNRFClient([]string{nrfConfig.RoamingURL}, remoteNRFConfig(nrfConfig, nrfConfig.RoamingTLS))
+		if err != nil {
+			stopAll()
+			return nil, err
+		}
+		roaming = client
+	}
+
+	return consumer.NewPLMNRouter(home, homePlmns, routes, roaming), nil
+}
+
+// remoteNRFConfig is the configuration of a client of a remote NRF.
+func remoteNRFConfig(nrfConfig *factory.NRF, tlsConfig *factory.ClientTLS) *factory.NRF {
+	remote := *nrfConfig
+	switch {
+	case tlsConfig != nil:
+		remote.TLS = tlsConfig
+	case nrfConfig.TLS != nil:
+		homeTLS := *nrfConfig.TLS
+		homeTLS.ServerName = ""
+		remote.TLS = &homeTLS
+	}
+	return &remote
+}
+
+// newSubscriptionManager returns nil when subscriptions are proxied to the
+// NRF as they are.
+func newSubscriptionManager(
+	config *factory.Config,
+	nrfClient *consumer.NRFClient,
+	profileCache *cache.NFProfileCache,
+) (*subscription.Manager, error) {
+	if !config.Subscriptions.FanOut {
+		return nil, nil
+	}
+
+	if config.Subscriptions.CallbackURI == "" {
+		return nil, fmt.Errorf("subscriptions config: callbackUri is required for fanOut")
+	}
+
+	notifier, err := consumer.NewNotifier(config.NRF.TLS, config.Subscriptions.NotifyTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	return subscription.NewManager(nrfClient, notifier, profileCache, config.Subscriptions.CallbackURI), nil
+}
+
 func (a *App) Start() error {
-	fmt.Println("Starting NFPCF (NF Profile Cache Function)...")
-	fmt.Printf("  Version: %s\n", a.config.Info.Version)
-	fmt.Printf("  Backend NRF: %s\n", a.config.NRF.URL)
-	fmt.Printf("  Cache TTL: %s\n", a.config.Cache.TTL)
+	logger.MainLog.Info("Starting NFPCF (NF Profile Cache Function)...")
+	logger.MainLog.Infof("Version: %s", a.config.Info.Version)
+	if settings, err := a.config.RedactedSettings(); err == nil {
+		for _, setting := range settings {
+			logger.MainLog.Infof("Config %s: %s", setting.Path, setting.Value)
+		}
+	}
+	homeEndpoints := make([]string, 0, len(a.config.NRF.HomeEndpoints()))
+	for _, endpoint := range a.config.NRF.HomeEndpoints() {
+		homeEndpoints = append(homeEndpoints, factory.RedactURL(endpoint))
+	}
+	logger.MainLog.Infof("Backend NRF: %v (%s)", homeEndpoints, a.config.NRF.LoadBalancing)
+	for _, route := range a.config.NRF.PlmnRoutes {
+		logger.MainLog.Infof("NRF for PLMN %s-%s: %s", route.Plmn.Mcc, route.Plmn.Mnc, factory.RedactURL(route.URL))
+	}
+	if a.config.NRF.RoamingURL != "" {
+		logger.MainLog.Infof("Roaming NRF: %s", factory.RedactURL(a.config.NRF.RoamingURL))
+	}
+	logger.MainLog.Infof("Cache TTL: %s", a.config.Cache.TTL)
+	if a.config.Subscriptions.FanOut {
+		logger.MainLog.Infof("Subscription fan-out: notifications via %s", a.config.Subscriptions.CallbackURI)
+	}
 
 	go a.handleSignals()
 
-	if err := a.server.Run(); err != nil {
+	if a.source != nil && a.source.Path != "" && a.config.Reload.WatchFile {
+		logger.MainLog.Infof("Watching %s for config changes", a.source.Path)
+		go a.watchConfig(a.config.Reload.Interval)
+	}
+
+	if a.metricsServer != nil {
+		logger.MainLog.Infof("NFPCF metrics listening on %s/metrics", a.metricsServer.Addr)
+		go func() {
+			if err := a.metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.MainLog.Errorf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
+	if a.adminServer != nil {
+		go func() {
+			if err := a.adminServer.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.MainLog.Errorf("Admin server error: %v", err)
+			}
+		}()
+	}
+
+	if err := a.server.Run(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("server error: %w", err)
 	}
 
+	// The listeners closed because Stop began; wait until it completes
+	<-a.stopped
 	return nil
 }
 
+// Stop shuts NFPCF down gracefully. Only the first call has an effect.
 func (a *App) Stop() {
-	fmt.Println("Stopping NFPCF...")
+	a.stopOnce.Do(a.shutdown)
+}
+
+func (a *App) shutdown() {
+	logger.MainLog.Info("Stopping NFPCF...")
+	defer close(a.stopped)
+
+	if a.server != nil {
+		a.server.SetDraining()
+		if delay := a.config.Shutdown.ReadinessDelay; delay > 0 && a.server.Listening() {
+			logger.MainLog.Infof("Readiness failed, closing listeners in %s", delay)
+			time.Sleep(delay)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), a.config.Shutdown.DrainTimeout)
+		if err := a.server.Shutdown(ctx); err != nil {
+			logger.MainLog.Warnf("SBI server shutdown: %v", err)
+		}
+		cancel()
+	}
+
+	if a.processor != nil {
+		if subscriptions := a.processor.GetSubscriptions(); subscriptions != nil {
+			subscriptions.Stop()
+			ctx, cancel := context.WithTimeout(context.Background(), subscriptionRemovalTimeout)
+			subscriptions.RemoveAll(ctx)
+			cancel()
+		}
+	}
 
 	if a.cache != nil {
 		a.cache.Stop()
+		if file := a.config.Cache.SnapshotFile; file != "" {
+			if err := a.cache.SaveSnapshot(file); err != nil {
+				logger.MainLog.Warnf("Failed to snapshot cache: %v", err)
+			} else {
+				logger.MainLog.Infof("Cache snapshot saved to %s", file)
+			}
+		}
 	}
 
-	if a.server != nil {
-		a.server.Shutdown()
+	if a.metricsServer != nil {
+		a.metricsServer.Close()
+	}
+
+	if a.adminServer != nil {
+		a.adminServer.Shutdown()
+	}
+
+	if a.tracingShutdown != nil {
+		// Flush the spans still buffered
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := a.tracingShutdown(ctx); err != nil {
+			logger.MainLog.Warnf("Failed to flush traces: %v", err)
+		}
+		cancel()
+	}
+
+	if a.processor != nil {
+		a.processor.GetPLMNRouter().Stop()
 	}
 
 	a.cancel()
+	logger.MainLog.Info("NFPCF stopped")
 }
 
 func (a *App) handleSignals() {
 	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case sig := <-sigCh:
+			if sig == syscall.SIGHUP {
+				logger.MainLog.Info("Received SIGHUP, reloading config")
+				if err := a.Reload(); err != nil {
+					logger.MainLog.Errorf("Config reload failed, keeping the running config: %v", err)
+				}
+				continue
+			}
+			logger.MainLog.Info("Received shutdown signal")
+			a.Stop()
+			return
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
 
-	select {
-	case <-sigCh:
-		fmt.Println("\nReceived shutdown signal")
-		a.Stop()
-	case <-a.ctx.Done():
-		return
+// ttlPolicies converts the configured TTL policies for the cache.
+func ttlPolicies(config *factory.Cache) []cache.TTLPolicy {
+	policies := make([]cache.TTLPolicy, 0, len(config.TTLPolicies))
+	for _, policy := range config.TTLPolicies {
+		policies = append(policies, cache.TTLPolicy{
+			NfType: policy.NfType,
+			Query:  policy.Query,
+			TTL:    policy.TTL,
+		})
 	}
+	return policies
 }
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/nfpcf/pkg/factory"
+	"github.com/free5gc/openapi/models"
+)
+
+// newTLSNRF starts an HTTP/2 NRF answering discoveries over TLS and returns
+// it with the path of its CA certificate.
+func newTLSNRF(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"validityPeriod":60,"nfInstances":[]}`))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caCert, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return server, caCert
+}
+
+func TestPLMNRouterTLS(t *testing.T) {
+	home, homeCA := newTLSNRF(t)
+	remote, remoteCA := newTLSNRF(t)
+
+	remotePlmn := factory.PlmnID{Mcc: "001", Mnc: "01"}
+	homeTLS := &factory.ClientTLS{CACert: homeCA, ServerName: "nrf.home.example"}
+
+	tests := []struct {
+		name    string
+		homeTLS *factory.ClientTLS
+		route   *factory.ClientTLS
+		roaming *factory.ClientTLS
+		useRoam bool
+		home    bool
+		wantErr bool
+	}{
+		{
+			name:    "route TLS",
+			homeTLS: homeTLS,
+			route:   &factory.ClientTLS{CACert: remoteCA},
+		},
+		{
+			name:    "roaming TLS",
+			homeTLS: homeTLS,
+			roaming: &factory.ClientTLS{CACert: remoteCA},
+			useRoam: true,
+		},
+		{
+			name:    "home TLS without its server name",
+			homeTLS: &factory.ClientTLS{CACert: remoteCA, ServerName: "nrf.home.example"},
+		},
+		{
+			// The test certificate does not name nrf.home.example
+			name:    "home NRF keeps its server name",
+			homeTLS: &factory.ClientTLS{CACert: remoteCA, ServerName: "nrf.home.example"},
+			home:    true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nrfConfig := &factory.NRF{
+				URL:            home.URL,
+				LoadBalancing:  consumer.PolicyPrimarySecondary,
+				HealthCheck:    &factory.HealthCheck{Path: "/", EjectionTime: time.Second},
+				Timeouts:       &factory.NRFTimeouts{Default: 2 * time.Second},
+				Retry:          &factory.Retry{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond, Multiplier: 2},
+				CircuitBreaker: &factory.CircuitBreaker{},
+				TLS:            tt.homeTLS,
+				HomePlmnList:   []factory.PlmnID{{Mcc: "208", Mnc: "93"}},
+			}
+			if tt.useRoam {
+				nrfConfig.RoamingURL = remote.URL
+				nrfConfig.RoamingTLS = tt.roaming
+			} else {
+				nrfConfig.PlmnRoutes = []factory.PlmnRoute{{Plmn: remotePlmn, URL: remote.URL, TLS: tt.route}}
+			}
+
+			homeClient, err := consumer.NewNRFClient(nrfConfig.HomeEndpoints(), nrfConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			router, err := newPLMNRouter(nrfConfig, homeClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer router.Stop()
+
+			targetPlmns := []models.PlmnId{{Mcc: remotePlmn.Mcc, Mnc: remotePlmn.Mnc}}
+			if tt.home {
+				targetPlmns = nil
+			}
+			client, target, err := router.Route(targetPlmns)
+			if err != nil || (target == consumer.HomeNRF) != tt.home {
+				t.Fatalf("Route() = target %q, error %v", target, err)
+			}
+
+			_, _, err = client.DiscoverNF(context.Background(), url.Values{
+				"target-nf-type":    {"SMF"},
+				"requester-nf-type": {"AMF"},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DiscoverNF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
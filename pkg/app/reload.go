@@ -0,0 +1,154 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/sbi/consumer"
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+// ConfigSource tells the App how to read its configuration again on reload.
+// Path, if set, is watched for changes when reload.watchFile is enabled.
+type ConfigSource struct {
+	Path string
+	Load func() (*factory.Config, error)
+}
+
+// Reload applies the cache TTLs, logger and home NRF endpoints of the
+// configuration file if it is valid; other changes need a restart.
+func (a *App) Reload() error {
+	if a.source == nil || a.source.Load == nil {
+		return fmt.Errorf("no configuration source to reload from")
+	}
+
+	a.reloadLock.Lock()
+	defer a.reloadLock.Unlock()
+
+	loaded, err := a.source.Load()
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	if err := loaded.Validate(); err != nil {
+		return err
+	}
+
+	current := factory.NfpcfConfig()
+	next, err := current.Clone()
+	if err != nil {
+		return fmt.Errorf("copy config: %w", err)
+	}
+
+	next.Cache.TTL = loaded.Cache.TTL
+	next.Cache.StaleTTL = loaded.Cache.StaleTTL
+	next.Cache.TTLPolicies = loaded.Cache.TTLPolicies
+	next.Logger.Level = loaded.Logger.Level
+	next.Logger.Format = loaded.Logger.Format
+	next.NRF.URL = loaded.NRF.URL
+	next.NRF.Endpoints = loaded.NRF.Endpoints
+
+	if err := validateLiveSettings(next); err != nil {
+		return err
+	}
+
+	for _, path := range factory.Diff(next, loaded) {
+		logger.MainLog.Warnf("Config reload: %s changed but requires a restart; keeping the running value", path)
+	}
+
+	// The admin API changes the running TTLs only, and the file wins over it
+	ttl, staleTTL := a.cache.TTLs()
+	ttlsChanged := next.Cache.TTL != ttl || next.Cache.StaleTTL != staleTTL
+
+	changed := factory.Diff(current, next)
+	if len(changed) == 0 && !ttlsChanged {
+		logger.MainLog.Info("Config reload: no live setting changed")
+		return nil
+	}
+
+	if ttlsChanged {
+		if ttl != current.Cache.TTL || staleTTL != current.Cache.StaleTTL {
+			logger.MainLog.Infof("Config reload: replacing the cache TTLs set at runtime (ttl %s, staleTtl %s)",
+				ttl, staleTTL)
+		}
+		// Validated above
+		a.cache.SetTTLs(next.Cache.TTL, next.Cache.StaleTTL)
+	}
+	if slices.Contains(changed, "cache.ttlPolicies") {
+		// Validated above
+		a.cache.SetTTLPolicies(ttlPolicies(next.Cache))
+	}
+	if next.Logger.Level != current.Logger.Level {
+		logger.SetLevel(next.Logger.Level)
+	}
+	if next.Logger.Format != current.Logger.Format {
+		logger.SetFormat(next.Logger.Format)
+	}
+	if !slices.Equal(next.NRF.HomeEndpoints(), current.NRF.HomeEndpoints()) {
+		a.processor.GetNRFClient().SetEndpoints(next.NRF.HomeEndpoints())
+	}
+
+	factory.SetNfpcfConfig(next)
+	if len(changed) > 0 {
+		logger.MainLog.Infof("Config reloaded: %s", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+// validateLiveSettings checks the settings Reload applies, so that either
+// all of them or none are applied.
+func validateLiveSettings(config *factory.Config) error {
+	if config.Cache.TTL <= 0 {
+		return fmt.Errorf("cache.ttl must be positive, got %s", config.Cache.TTL)
+	}
+	if config.Cache.StaleTTL < 0 {
+		return fmt.Errorf("cache.staleTtl must not be negative, got %s", config.Cache.StaleTTL)
+	}
+	if err := cache.ValidateTTLPolicies(ttlPolicies(config.Cache)); err != nil {
+		return fmt.Errorf("cache.ttlPolicies: %w", err)
+	}
+	if err := logger.ValidateLevel(config.Logger.Level); err != nil {
+		return err
+	}
+	if err := logger.ValidateFormat(config.Logger.Format); err != nil {
+		return err
+	}
+	return consumer.ValidateEndpoints(config.NRF.HomeEndpoints())
+}
+
+// watchConfig reloads the configuration when the modification time of the
+// file changes.
+func (a *App) watchConfig(interval time.Duration) {
+	modTime := func() time.Time {
+		info, err := os.Stat(a.source.Path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := modTime()
+	for {
+		select {
+		case <-ticker.C:
+			current := modTime()
+			if current.IsZero() || current.Equal(last) {
+				continue
+			}
+			last = current
+			logger.MainLog.Infof("Config file %s changed, reloading", a.source.Path)
+			if err := a.Reload(); err != nil {
+				logger.MainLog.Errorf("Config reload failed, keeping the running config: %v", err)
+			}
+		case <-a.ctx.Done():
+			return
+		}
+	}
+}
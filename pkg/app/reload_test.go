@@ -0,0 +1,65 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/cache"
+	"github.com/free5gc/nfpcf/pkg/factory"
+)
+
+func TestReloadAppliesFileTTLs(t *testing.T) {
+	config := func(ttl string) string {
+		return "info:\n  version: 1.0.0\nnrf:\n  url: http://nrf:8000\ncache:\n  ttl: " + ttl + "\n  staleTtl: 1m\n"
+	}
+
+	tests := []struct {
+		name     string
+		adminTTL time.Duration
+		fileTTL  string
+		want     time.Duration
+	}{
+		{"file changed", 0, "2m", 2 * time.Minute},
+		{"admin change, file unchanged", 10 * time.Second, "5m", 5 * time.Minute},
+		{"admin change, file changed", 10 * time.Second, "2m", 2 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "nfpcfcfg.yaml")
+			if err := os.WriteFile(path, []byte(config("5m")), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			initial, err := factory.ReadConfig(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			factory.SetNfpcfConfig(initial)
+
+			a := &App{
+				cache: cache.NewNFProfileCache(initial.Cache.TTL, initial.Cache.StaleTTL, 0),
+				source: &ConfigSource{Path: path, Load: func() (*factory.Config, error) {
+					return factory.ReadConfig(path)
+				}},
+			}
+			defer a.cache.Stop()
+
+			if tt.adminTTL > 0 {
+				if err := a.cache.SetTTLs(tt.adminTTL, time.Minute); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(path, []byte(config(tt.fileTTL)), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := a.Reload(); err != nil {
+				t.Fatal(err)
+			}
+			if ttl, _ := a.cache.TTLs(); ttl != tt.want {
+				t.Errorf("ttl = %s, want %s", ttl, tt.want)
+			}
+		})
+	}
+}
@@ -2,18 +2,28 @@ package factory
 
 import (
 	"io"
+	"net"
 	"os"
+	"reflect"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/yaml.v2"
 )
 
 type Config struct {
-	Info        *Info        `yaml:"info"`
-	Server      *Server      `yaml:"server"`
-	NRF         *NRF         `yaml:"nrf"`
-	Cache       *Cache       `yaml:"cache"`
-	Logger      *Logger      `yaml:"logger"`
+	Info          *Info          `yaml:"info"`
+	Server        *Server        `yaml:"server"`
+	NRF           *NRF           `yaml:"nrf"`
+	Cache         *Cache         `yaml:"cache"`
+	Logger        *Logger        `yaml:"logger"`
+	Ordering      *Ordering      `yaml:"ordering"`
+	Subscriptions *Subscriptions `yaml:"subscriptions"`
+	Metrics       *Metrics       `yaml:"metrics"`
+	Tracing       *Tracing       `yaml:"tracing"`
+	Admin         *Admin         `yaml:"admin"`
+	Shutdown      *Shutdown      `yaml:"shutdown"`
+	Reload        *Reload        `yaml:"reload"`
 }
 
 type Info struct {
@@ -22,24 +32,305 @@ type Info struct {
 }
 
 type Server struct {
-	BindAddr string `yaml:"bindAddr"`
+	BindAddr string         `yaml:"bindAddr"`
+	TLS      *ServerTLS     `yaml:"tls"`
+	OAuth2   *InboundOAuth2 `yaml:"oauth2"`
+}
+
+// InboundOAuth2 validates the NRF access tokens of inbound SBI requests.
+type InboundOAuth2 struct {
+	Enable    bool     `yaml:"enable"`
+	Keys      []string `yaml:"keys"`
+	Issuer    string   `yaml:"issuer"`
+	Audiences []string `yaml:"audiences"`
+}
+
+// ServerTLS enables TLS on the SBI, next to h2c when BindAddr is set.
+type ServerTLS struct {
+	BindAddr       string        `yaml:"bindAddr"`
+	Cert           string        `yaml:"cert"`
+	Key            string        `yaml:"key"`
+	ClientCA       string        `yaml:"clientCa"`
+	ClientAuth     string        `yaml:"clientAuth"`
+	MinVersion     string        `yaml:"minVersion"`
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
 }
 
+// NRF configures the home NRF and the NRFs of other PLMNs.
 type NRF struct {
-	URL string `yaml:"url"`
+	URL            string          `yaml:"url"`
+	Endpoints      []string        `yaml:"endpoints"`
+	LoadBalancing  string          `yaml:"loadBalancing"`
+	HealthCheck    *HealthCheck    `yaml:"healthCheck"`
+	Timeouts       *NRFTimeouts    `yaml:"timeouts"`
+	Retry          *Retry          `yaml:"retry"`
+	CircuitBreaker *CircuitBreaker `yaml:"circuitBreaker"`
+	TLS            *ClientTLS      `yaml:"tls"`
+	OAuth2         *OAuth2         `yaml:"oauth2"`
+	HomePlmnList   []PlmnID        `yaml:"homePlmnList"`
+	PlmnRoutes     []PlmnRoute     `yaml:"plmnRoutes"`
+	RoamingURL     string          `yaml:"roamingUrl"`
+	RoamingTLS     *ClientTLS      `yaml:"roamingTls"`
+}
+
+// HomeEndpoints returns the home NRF endpoints in configured order.
+func (n *NRF) HomeEndpoints() []string {
+	if len(n.Endpoints) > 0 {
+		return n.Endpoints
+	}
+	return []string{n.URL}
+}
+
+// HealthCheck configures active probing of the NRF endpoints.
+type HealthCheck struct {
+	Enable       bool          `yaml:"enable"`
+	Interval     time.Duration `yaml:"interval"`
+	Timeout      time.Duration `yaml:"timeout"`
+	Path         string        `yaml:"path"`
+	EjectionTime time.Duration `yaml:"ejectionTime"`
+}
+
+const defaultHealthCheckInterval = 10 * time.Second
+
+// UnmarshalYAML enables probing every 10s unless the section sets enable or
+// interval, so only an explicit false or 0 turns it off.
+func (hc *HealthCheck) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain HealthCheck
+	decoded := plain{Enable: true, Interval: defaultHealthCheckInterval}
+	if err := unmarshal(&decoded); err != nil {
+		return err
+	}
+	*hc = HealthCheck(decoded)
+	return nil
+}
+
+// NRF operations with a timeout of their own.
+const (
+	OpRegister   = "register"
+	OpGet        = "get"
+	OpDeregister = "deregister"
+	OpUpdate     = "update"
+	OpDiscover   = "discover"
+	OpSubscribe  = "subscribe"
+)
+
+// NRFTimeouts bounds each attempt of an NRF operation. Default applies to
+// operations without a dedicated timeout.
+type NRFTimeouts struct {
+	Default    time.Duration `yaml:"default"`
+	Register   time.Duration `yaml:"register"`
+	Get        time.Duration `yaml:"get"`
+	Deregister time.Duration `yaml:"deregister"`
+	Update     time.Duration `yaml:"update"`
+	Discover   time.Duration `yaml:"discover"`
+	Subscribe  time.Duration `yaml:"subscribe"`
+}
+
+// For returns the timeout of the named operation.
+func (t *NRFTimeouts) For(op string) time.Duration {
+	var d time.Duration
+	switch op {
+	case OpRegister:
+		d = t.Register
+	case OpGet:
+		d = t.Get
+	case OpDeregister:
+		d = t.Deregister
+	case OpUpdate:
+		d = t.Update
+	case OpDiscover:
+		d = t.Discover
+	case OpSubscribe:
+		d = t.Subscribe
+	}
+	if d == 0 {
+		d = t.Default
+	}
+	return d
+}
+
+// Retry configures the jittered exponential backoff between attempts of an
+// NRF operation. MaxAttempts 1 disables retries.
+type Retry struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+}
+
+// CircuitBreaker configures the circuit breaker kept per NRF endpoint.
+type CircuitBreaker struct {
+	Enable              bool          `yaml:"enable"`
+	ConsecutiveFailures int           `yaml:"consecutiveFailures"`
+	ErrorRateThreshold  float64       `yaml:"errorRateThreshold"`
+	MinRequests         int           `yaml:"minRequests"`
+	Window              time.Duration `yaml:"window"`
+	OpenTimeout         time.Duration `yaml:"openTimeout"`
+	HalfOpenMaxRequests int           `yaml:"halfOpenMaxRequests"`
+}
+
+// UnmarshalYAML enables a configured circuit breaker unless it sets enable.
+func (cb *CircuitBreaker) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain CircuitBreaker
+	decoded := plain{Enable: true}
+	if err := unmarshal(&decoded); err != nil {
+		return err
+	}
+	*cb = CircuitBreaker(decoded)
+	return nil
+}
+
+// ClientTLS configures TLS toward https:// NRFs.
+type ClientTLS struct {
+	CACert     string `yaml:"caCert"`
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+	ServerName string `yaml:"serverName"`
+	MinVersion string `yaml:"minVersion"`
 }
 
+// OAuth2 authenticates NFPCF's own NRF requests with access tokens.
+type OAuth2 struct {
+	Enable               bool          `yaml:"enable"`
+	NfInstanceID         string        `yaml:"nfInstanceId"`
+	NfType               string        `yaml:"nfType"`
+	ExpiryMargin         time.Duration `yaml:"expiryMargin"`
+	DefaultExpiry        time.Duration `yaml:"defaultExpiry"`
+	ForwardConsumerToken bool          `yaml:"forwardConsumerToken"`
+}
+
+type PlmnID struct {
+	Mcc string `yaml:"mcc"`
+	Mnc string `yaml:"mnc"`
+}
+
+type PlmnRoute struct {
+	Plmn PlmnID     `yaml:"plmn"`
+	URL  string     `yaml:"url"`
+	TLS  *ClientTLS `yaml:"tls"`
+}
+
+// Cache configures entry lifetimes and the optional snapshot file.
 type Cache struct {
-	TTL time.Duration `yaml:"ttl"`
+	TTL               time.Duration `yaml:"ttl"`
+	TTLPolicies       []TTLPolicy   `yaml:"ttlPolicies"`
+	StaleTTL          time.Duration `yaml:"staleTtl"`
+	TokenExpiryMargin time.Duration `yaml:"tokenExpiryMargin"`
+	SnapshotFile      string        `yaml:"snapshotFile"`
+}
+
+// defaultCacheTTL is the TTL of a configuration that does not set one.
+const defaultCacheTTL = 5 * time.Minute
+
+// UnmarshalYAML defaults TTL when the section does not set it, so that an
+// explicit 0 is rejected by validation.
+func (c *Cache) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain Cache
+	decoded := plain{TTL: defaultCacheTTL}
+	if err := unmarshal(&decoded); err != nil {
+		return err
+	}
+	*c = Cache(decoded)
+	return nil
+}
+
+// TTLPolicy sets the TTL of entries of NfType whose query matches Query.
+type TTLPolicy struct {
+	NfType string            `yaml:"nfType"`
+	Query  map[string]string `yaml:"query,omitempty"`
+	TTL    time.Duration     `yaml:"ttl"`
+}
+
+// Ordering selects how discovered NF instances are ordered in responses.
+type Ordering struct {
+	DefaultPolicy  string            `yaml:"defaultPolicy"`
+	NfTypePolicies map[string]string `yaml:"nfTypePolicies"`
+}
+
+// Subscriptions configures the NRF subscription API. With FanOut NFPCF
+// relays the notifications of one NRF subscription per filter.
+type Subscriptions struct {
+	FanOut        bool          `yaml:"fanOut"`
+	CallbackURI   string        `yaml:"callbackUri"`
+	NotifyTimeout time.Duration `yaml:"notifyTimeout"`
 }
 
+// Metrics serves Prometheus metrics on /metrics of a listener separate from
+// the SBI.
+type Metrics struct {
+	Enable   bool   `yaml:"enable"`
+	BindAddr string `yaml:"bindAddr"`
+}
+
+// Admin configures the cache administration API. A Token needs TLS unless
+// BindAddr is loopback.
+type Admin struct {
+	Enable   bool       `yaml:"enable"`
+	BindAddr string     `yaml:"bindAddr"`
+	Token    string     `yaml:"token" secret:"true"`
+	TLS      *ServerTLS `yaml:"tls"`
+}
+
+// Loopback reports whether BindAddr only accepts local connections.
+func (a *Admin) Loopback() bool {
+	host, _, err := net.SplitHostPort(a.BindAddr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Shutdown configures the graceful shutdown on SIGINT or SIGTERM.
+type Shutdown struct {
+	DrainTimeout   time.Duration `yaml:"drainTimeout"`
+	ReadinessDelay time.Duration `yaml:"readinessDelay"`
+}
+
+// Reload configures reloads on SIGHUP and, with WatchFile, on file changes.
+type Reload struct {
+	WatchFile bool          `yaml:"watchFile"`
+	Interval  time.Duration `yaml:"interval"`
+}
+
+// Tracing exports OpenTelemetry spans.
+type Tracing struct {
+	Enable      bool    `yaml:"enable"`
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	File        string  `yaml:"file"`
+	ServiceName string  `yaml:"serviceName"`
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// Logger sets the log level (trace, debug, info, warn, error, fatal, panic)
+// and the output format, "text" or "json".
 type Logger struct {
-	Level string `yaml:"level"`
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// nfpcfConfig is the effective configuration. A reload replaces it as a
+// whole, so readers never see a partially applied configuration.
+var nfpcfConfig atomic.Pointer[Config]
+
+// NfpcfConfig returns the effective configuration. It is safe for concurrent
+// use; the returned Config must not be modified.
+func NfpcfConfig() *Config {
+	return nfpcfConfig.Load()
 }
 
-var NfpcfConfig *Config
+// SetNfpcfConfig publishes config as the effective configuration.
+func SetNfpcfConfig(config *Config) {
+	nfpcfConfig.Store(config)
+}
 
-func ReadConfig(path string) (*Config, error) {
+// ReadConfig reads, overrides, defaults and validates the configuration at
+// path. All problems are reported together as a *ValidationError.
+func ReadConfig(path string, overrides ...Override) (*Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -51,23 +342,203 @@ func ReadConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	v := &validator{}
 	config := &Config{}
-	if err := yaml.Unmarshal(data, config); err != nil {
-		return nil, err
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		// Type errors leave the other settings decoded, so validation goes on
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return nil, err
+		}
+		v.problems = append(v.problems, typeErr.Errors...)
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err == nil {
+		bareDurations(v, "", reflect.TypeOf(Config{}), raw)
 	}
 
+	config.apply(overrides, v)
+
 	if config.Cache == nil {
-		config.Cache = &Cache{TTL: 5 * time.Minute}
+		config.Cache = &Cache{TTL: defaultCacheTTL}
+	}
+
+	if config.Cache.TokenExpiryMargin == 0 {
+		config.Cache.TokenExpiryMargin = 30 * time.Second
 	}
 
 	if config.Server == nil {
-		config.Server = &Server{BindAddr: ":8000"}
+		config.Server = &Server{}
+	}
+
+	if config.Server.BindAddr == "" {
+		config.Server.BindAddr = ":8000"
+	}
+
+	if config.Server.TLS != nil && config.Server.TLS.ReloadInterval == 0 {
+		config.Server.TLS.ReloadInterval = 30 * time.Second
 	}
 
 	if config.Logger == nil {
 		config.Logger = &Logger{Level: "info"}
 	}
 
-	NfpcfConfig = config
+	if config.Logger.Level == "" {
+		config.Logger.Level = "info"
+	}
+
+	if config.Logger.Format == "" {
+		config.Logger.Format = "text"
+	}
+
+	if config.NRF != nil {
+		if config.NRF.LoadBalancing == "" {
+			config.NRF.LoadBalancing = "primary-secondary"
+		}
+		if config.NRF.HealthCheck == nil {
+			config.NRF.HealthCheck = &HealthCheck{Enable: true, Interval: defaultHealthCheckInterval}
+		}
+		if config.NRF.HealthCheck.Timeout == 0 {
+			config.NRF.HealthCheck.Timeout = 2 * time.Second
+		}
+		if config.NRF.HealthCheck.Path == "" {
+			config.NRF.HealthCheck.Path = "/"
+		}
+		if config.NRF.HealthCheck.EjectionTime == 0 {
+			config.NRF.HealthCheck.EjectionTime = 30 * time.Second
+		}
+		if config.NRF.Timeouts == nil {
+			config.NRF.Timeouts = &NRFTimeouts{}
+		}
+		if config.NRF.Timeouts.Default == 0 {
+			config.NRF.Timeouts.Default = 5 * time.Second
+		}
+		if config.NRF.Retry == nil {
+			config.NRF.Retry = &Retry{}
+		}
+		if config.NRF.Retry.MaxAttempts == 0 {
+			config.NRF.Retry.MaxAttempts = 3
+		}
+		if config.NRF.Retry.InitialBackoff == 0 {
+			config.NRF.Retry.InitialBackoff = 100 * time.Millisecond
+		}
+		if config.NRF.Retry.MaxBackoff == 0 {
+			config.NRF.Retry.MaxBackoff = 2 * time.Second
+		}
+		if config.NRF.Retry.Multiplier == 0 {
+			config.NRF.Retry.Multiplier = 2
+		}
+		if config.NRF.CircuitBreaker == nil {
+			config.NRF.CircuitBreaker = &CircuitBreaker{Enable: true}
+		}
+		if config.NRF.CircuitBreaker.ConsecutiveFailures == 0 {
+			config.NRF.CircuitBreaker.ConsecutiveFailures = 5
+		}
+		if config.NRF.CircuitBreaker.ErrorRateThreshold == 0 {
+			config.NRF.CircuitBreaker.ErrorRateThreshold = 0.5
+		}
+		if config.NRF.CircuitBreaker.MinRequests == 0 {
+			config.NRF.CircuitBreaker.MinRequests = 20
+		}
+		if config.NRF.CircuitBreaker.Window == 0 {
+			config.NRF.CircuitBreaker.Window = 30 * time.Second
+		}
+		if config.NRF.CircuitBreaker.OpenTimeout == 0 {
+			config.NRF.CircuitBreaker.OpenTimeout = 30 * time.Second
+		}
+		if config.NRF.CircuitBreaker.HalfOpenMaxRequests == 0 {
+			config.NRF.CircuitBreaker.HalfOpenMaxRequests = 1
+		}
+		if oauth2 := config.NRF.OAuth2; oauth2 != nil {
+			if oauth2.ExpiryMargin == 0 {
+				oauth2.ExpiryMargin = 30 * time.Second
+			}
+			if oauth2.DefaultExpiry == 0 {
+				oauth2.DefaultExpiry = 5 * time.Minute
+			}
+		}
+	}
+
+	if config.Ordering == nil {
+		config.Ordering = &Ordering{}
+	}
+
+	if config.Ordering.DefaultPolicy == "" {
+		config.Ordering.DefaultPolicy = "none"
+	}
+
+	if config.Subscriptions == nil {
+		config.Subscriptions = &Subscriptions{}
+	}
+
+	if config.Subscriptions.NotifyTimeout == 0 {
+		config.Subscriptions.NotifyTimeout = 5 * time.Second
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = &Metrics{}
+	}
+
+	if config.Metrics.BindAddr == "" {
+		config.Metrics.BindAddr = ":9090"
+	}
+
+	if config.Tracing == nil {
+		config.Tracing = &Tracing{}
+	}
+
+	if config.Tracing.Exporter == "" {
+		config.Tracing.Exporter = "otlp"
+	}
+
+	if config.Tracing.Endpoint == "" {
+		config.Tracing.Endpoint = "http://localhost:4318"
+	}
+
+	if config.Tracing.ServiceName == "" {
+		config.Tracing.ServiceName = "nfpcf"
+	}
+
+	if config.Tracing.SampleRatio == 0 {
+		config.Tracing.SampleRatio = 1
+	}
+
+	if config.Admin == nil {
+		config.Admin = &Admin{}
+	}
+
+	if config.Admin.BindAddr == "" {
+		config.Admin.BindAddr = "127.0.0.1:9091"
+	}
+
+	if config.Admin.TLS != nil && config.Admin.TLS.ReloadInterval == 0 {
+		config.Admin.TLS.ReloadInterval = 30 * time.Second
+	}
+
+	if config.Shutdown == nil {
+		config.Shutdown = &Shutdown{}
+	}
+
+	if config.Shutdown.DrainTimeout == 0 {
+		config.Shutdown.DrainTimeout = 30 * time.Second
+	}
+
+	if config.Reload == nil {
+		config.Reload = &Reload{}
+	}
+
+	if config.Reload.Interval == 0 {
+		config.Reload.Interval = 5 * time.Second
+	}
+
+	if config.Info == nil {
+		config.Info = &Info{}
+	}
+
+	config.validate(v)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
@@ -0,0 +1,249 @@
+package factory
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const baseConfig = `
+info:
+  version: 1.0.0
+nrf:
+  url: http://nrf:8000
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "nfpcfcfg.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// problems returns the problems of a *ValidationError, failing the test on
+// any other error.
+func problems(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+	return validationErr.Problems
+}
+
+// hasProblem reports whether one of problems is about the setting at path.
+func hasProblem(problems []string, path string) bool {
+	for _, problem := range problems {
+		if strings.HasPrefix(problem, path+": ") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		overrides []Override
+		want      time.Duration
+		wantErr   bool
+	}{
+		{name: "section absent", config: baseConfig, want: 5 * time.Minute},
+		{name: "key absent", config: baseConfig + `
+cache:
+  staleTtl: 1m
+`, want: 5 * time.Minute},
+		{name: "set", config: baseConfig + `
+cache:
+  ttl: 30s
+`, want: 30 * time.Second},
+		{name: "zero", config: baseConfig + `
+cache:
+  ttl: 0
+`, wantErr: true},
+		{name: "zero with unit", config: baseConfig + `
+cache:
+  ttl: 0s
+`, wantErr: true},
+		{name: "section created by override", config: baseConfig, overrides: []Override{
+			{Path: "cache.staleTtl", Value: "1m", Source: "NFPCF_CACHE_STALE_TTL"},
+		}, want: 5 * time.Minute},
+		{name: "zero by override", config: baseConfig, overrides: []Override{
+			{Path: "cache.ttl", Value: "0s", Source: "NFPCF_CACHE_TTL"},
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ReadConfig(writeConfig(t, tt.config), tt.overrides...)
+			if tt.wantErr {
+				if !hasProblem(problems(t, err), "cache.ttl") {
+					t.Fatalf("ReadConfig() error = %v, want a cache.ttl problem", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Cache.TTL != tt.want {
+				t.Errorf("cache.ttl = %s, want %s", config.Cache.TTL, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigReportsAllProblems(t *testing.T) {
+	path := writeConfig(t, baseConfig+`
+  loadBalancing: random
+  retry:
+    maxAttempts: three
+  unknownSetting: true
+cache:
+  ttl: 0
+  staleTtl: 30
+logger:
+  level: loud
+`)
+	overrides := []Override{{Path: "reload.interval", Value: "soon", Source: "--reload.interval"}}
+
+	_, err := ReadConfig(path, overrides...)
+	got := problems(t, err)
+	for _, want := range []string{
+		"nrf.loadBalancing",
+		"cache.ttl",
+		"cache.staleTtl",
+		"logger.level",
+		"--reload.interval",
+	} {
+		if !hasProblem(got, want) {
+			t.Errorf("no %s problem in %q", want, got)
+		}
+	}
+	// yaml reports type errors and unknown settings by line
+	for _, want := range []string{"cannot unmarshal", "field unknownSetting not found"} {
+		found := false
+		for _, problem := range got {
+			found = found || strings.Contains(problem, want)
+		}
+		if !found {
+			t.Errorf("no problem containing %q in %q", want, got)
+		}
+	}
+}
+
+func TestAdminLoopback(t *testing.T) {
+	tests := []struct {
+		bindAddr string
+		want     bool
+	}{
+		{"127.0.0.1:9091", true},
+		{"127.0.0.2:9091", true},
+		{"[::1]:9091", true},
+		{"localhost:9091", true},
+		{":9091", false},
+		{"0.0.0.0:9091", false},
+		{"10.0.0.1:9091", false},
+		{"admin.example:9091", false},
+		{"9091", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.bindAddr, func(t *testing.T) {
+			admin := &Admin{BindAddr: tt.bindAddr}
+			if got := admin.Loopback(); got != tt.want {
+				t.Errorf("Loopback() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerEnable(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		overrides []Override
+		want      bool
+	}{
+		{name: "section absent", config: baseConfig, want: true},
+		{name: "section without enable", config: baseConfig + `
+  circuitBreaker:
+    consecutiveFailures: 3
+`, want: true},
+		{name: "disabled", config: baseConfig + `
+  circuitBreaker:
+    enable: false
+`, want: false},
+		{name: "section created by override", config: baseConfig, overrides: []Override{
+			{Path: "nrf.circuitBreaker.window", Value: "10s", Source: "NFPCF_NRF_CIRCUIT_BREAKER_WINDOW"},
+		}, want: true},
+		{name: "disabled by override", config: baseConfig, overrides: []Override{
+			{Path: "nrf.circuitBreaker.enable", Value: "false", Source: "NFPCF_NRF_CIRCUIT_BREAKER_ENABLE"},
+		}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ReadConfig(writeConfig(t, tt.config), tt.overrides...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := config.NRF.CircuitBreaker.Enable; got != tt.want {
+				t.Errorf("circuitBreaker.enable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHealthCheckDefaults(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       string
+		overrides    []Override
+		wantEnable   bool
+		wantInterval time.Duration
+	}{
+		{name: "section absent", config: baseConfig, wantEnable: true, wantInterval: 10 * time.Second},
+		{name: "section with path only", config: baseConfig + `
+  healthCheck:
+    path: /nnrf-nfm/v1/nf-instances
+`, wantEnable: true, wantInterval: 10 * time.Second},
+		{name: "section with ejection time only", config: baseConfig + `
+  healthCheck:
+    ejectionTime: 1m
+`, wantEnable: true, wantInterval: 10 * time.Second},
+		{name: "interval set", config: baseConfig + `
+  healthCheck:
+    interval: 30s
+`, wantEnable: true, wantInterval: 30 * time.Second},
+		{name: "interval 0", config: baseConfig + `
+  healthCheck:
+    interval: 0
+`, wantEnable: true, wantInterval: 0},
+		{name: "disabled", config: baseConfig + `
+  healthCheck:
+    enable: false
+`, wantEnable: false, wantInterval: 10 * time.Second},
+		{name: "section created by override", config: baseConfig, overrides: []Override{
+			{Path: "nrf.healthCheck.path", Value: "/status", Source: "NFPCF_NRF_HEALTH_CHECK_PATH"},
+		}, wantEnable: true, wantInterval: 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ReadConfig(writeConfig(t, tt.config), tt.overrides...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hc := config.NRF.HealthCheck
+			if hc.Enable != tt.wantEnable || hc.Interval != tt.wantInterval {
+				t.Errorf("healthCheck enable %v, interval %s, want %v, %s",
+					hc.Enable, hc.Interval, tt.wantEnable, tt.wantInterval)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package factory
+
+import (
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Clone returns a deep copy of the configuration.
+func (c *Config) Clone() (*Config, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	clone := &Config{}
+	if err := yaml.Unmarshal(data, clone); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// Diff lists the settings that differ between two configurations by their
+// YAML path, e.g. "server.bindAddr". Lists and maps are compared as a whole.
+func Diff(a, b *Config) []string {
+	var paths []string
+	diffValue("", reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem(), &paths)
+	return paths
+}
+
+func diffValue(path string, a, b reflect.Value, paths *[]string) {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*paths = append(*paths, path)
+			}
+			return
+		}
+		diffValue(path, a.Elem(), b.Elem(), paths)
+	case reflect.Struct:
+		for i := 0; i < a.NumField(); i++ {
+			name, _, _ := strings.Cut(a.Type().Field(i).Tag.Get("yaml"), ",")
+			fieldPath := name
+			if path != "" {
+				fieldPath = path + "." + name
+			}
+			diffValue(fieldPath, a.Field(i), b.Field(i), paths)
+		}
+	case reflect.Slice, reflect.Map:
+		// An empty list or map is the same setting as an absent one
+		if a.Len() == 0 && b.Len() == 0 {
+			return
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*paths = append(*paths, path)
+		}
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*paths = append(*paths, path)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package factory
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+// EnvPrefix starts the environment variables overriding config settings.
+const EnvPrefix = "NFPCF_"
+
+// envAliases are environment variables kept for compatibility, by setting.
+// They take precedence over the file but not over NFPCF_* variables.
+var envAliases = map[string]string{
+	"nrf.url": "NRF_URL",
+}
+
+// Override sets the config setting at a YAML path such as "cache.ttl".
+type Override struct {
+	Path   string
+	Value  string
+	Source string
+}
+
+// Field is a config setting that can be overridden.
+type Field struct {
+	Path string
+	Env  string
+	Type reflect.Type
+}
+
+// Fields lists every setting of Config, in declaration order. Sections are
+// not settings themselves; lists and maps are.
+func Fields() []Field {
+	var fields []Field
+	walkFields(reflect.TypeOf(Config{}), "", &fields)
+	return fields
+}
+
+func walkFields(t reflect.Type, prefix string, fields *[]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		if field.Type.Kind() == reflect.Ptr && field.Type.Elem().Kind() == reflect.Struct {
+			walkFields(field.Type.Elem(), path, fields)
+			continue
+		}
+		*fields = append(*fields, Field{Path: path, Env: envName(path), Type: field.Type})
+	}
+}
+
+// envName derives the environment variable of a setting from its path:
+// "nrf.healthCheck.interval" is NFPCF_NRF_HEALTH_CHECK_INTERVAL.
+func envName(path string) string {
+	var b strings.Builder
+	b.WriteString(EnvPrefix)
+	for i, r := range path {
+		switch {
+		case r == '.':
+			b.WriteByte('_')
+		case unicode.IsUpper(r) && i > 0 && path[i-1] != '.' && !unicode.IsUpper(rune(path[i-1])):
+			b.WriteByte('_')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// EnvOverrides collects the overrides set in environ and the NFPCF_*
+// variables that match no setting.
+func EnvOverrides(environ []string, ignore ...string) ([]Override, []string) {
+	values := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if name, value, found := strings.Cut(kv, "="); found {
+			values[name] = value
+		}
+	}
+
+	var overrides []Override
+	known := make(map[string]bool)
+	for _, field := range Fields() {
+		known[field.Env] = true
+		if alias, exists := envAliases[field.Path]; exists {
+			if value, set := values[alias]; set {
+				overrides = append(overrides, Override{Path: field.Path, Value: value, Source: alias})
+			}
+		}
+		if value, set := values[field.Env]; set {
+			overrides = append(overrides, Override{Path: field.Path, Value: value, Source: field.Env})
+		}
+	}
+	for _, name := range ignore {
+		known[name] = true
+	}
+
+	var unknown []string
+	for name := range values {
+		if strings.HasPrefix(name, EnvPrefix) && !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	return overrides, unknown
+}
+
+// apply sets the overridden settings, creating the sections they belong to
+// if the file has none. Overrides that cannot be applied are reported to v.
+func (c *Config) apply(overrides []Override, v *validator) {
+	for _, override := range overrides {
+		if err := setPath(reflect.ValueOf(c).Elem(), override.Path, override.Value); err != nil {
+			v.addf(override.Source, "%v", err)
+		}
+	}
+}
+
+func setPath(v reflect.Value, path string, raw string) error {
+	name, rest, nested := strings.Cut(path, ".")
+
+	for i := 0; i < v.NumField(); i++ {
+		yamlName, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if yamlName != name {
+			continue
+		}
+
+		field := v.Field(i)
+		if !nested {
+			return setValue(field, raw)
+		}
+		if field.Kind() != reflect.Ptr || field.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+		if field.IsNil() {
+			// Decoding an empty section applies its YAML defaults
+			field.Set(reflect.New(field.Type().Elem()))
+			if err := yaml.Unmarshal([]byte("{}"), field.Interface()); err != nil {
+				return err
+			}
+		}
+		return setPath(field.Elem(), rest, raw)
+	}
+	return fmt.Errorf("unknown setting %q", path)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses raw into field. Lists of strings are comma separated;
+// other lists and maps take YAML flow syntax, e.g. "{SMF: weighted}".
+func setValue(field reflect.Value, raw string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(raw)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(b)
+	case field.Kind() >= reflect.Int && field.Kind() <= reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		field.SetFloat(f)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var list []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	default:
+		value := reflect.New(field.Type())
+		if err := yaml.Unmarshal([]byte(raw), value.Interface()); err != nil {
+			return fmt.Errorf("invalid value %q: %w", raw, err)
+		}
+		field.Set(value.Elem())
+	}
+	return nil
+}
+
+// Redacted renders the configuration as YAML with secrets replaced: fields
+// tagged `secret:"true"` and passwords in URLs.
+func (c *Config) Redacted() (string, error) {
+	clone, err := c.Clone()
+	if err != nil {
+		return "", err
+	}
+	redact(reflect.ValueOf(clone).Elem())
+
+	data, err := yaml.Marshal(clone)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Setting is the effective value of one config setting.
+type Setting struct {
+	Path  string
+	Value string
+}
+
+// RedactedSettings lists the settings that are set, with secrets replaced
+// as in Redacted, for logging one setting per line.
+func (c *Config) RedactedSettings() ([]Setting, error) {
+	clone, err := c.Clone()
+	if err != nil {
+		return nil, err
+	}
+	redact(reflect.ValueOf(clone).Elem())
+
+	var settings []Setting
+	collectSettings("", reflect.ValueOf(clone).Elem(), &settings)
+	return settings, nil
+}
+
+func collectSettings(prefix string, v reflect.Value, settings *[]Setting) {
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct:
+			if !field.IsNil() {
+				collectSettings(path, field.Elem(), settings)
+			}
+		case field.IsZero() || ((field.Kind() == reflect.Slice || field.Kind() == reflect.Map) && field.Len() == 0):
+		case field.Type() == durationType:
+			*settings = append(*settings, Setting{Path: path, Value: time.Duration(field.Int()).String()})
+		default:
+			*settings = append(*settings, Setting{Path: path, Value: fmt.Sprint(field.Interface())})
+		}
+	}
+}
+
+const redactedValue = "<redacted>"
+
+func redact(v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Ptr && !field.IsNil() && field.Elem().Kind() == reflect.Struct:
+			redact(field.Elem())
+		case field.Kind() == reflect.String && field.String() != "":
+			if v.Type().Field(i).Tag.Get("secret") == "true" {
+				field.SetString(redactedValue)
+			} else {
+				field.SetString(redactURL(field.String()))
+			}
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			for j := 0; j < field.Len(); j++ {
+				field.Index(j).SetString(redactURL(field.Index(j).String()))
+			}
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			for j := 0; j < field.Len(); j++ {
+				redact(field.Index(j))
+			}
+		}
+	}
+}
+
+// RedactURL hides the password of URLs with user information.
+func RedactURL(s string) string {
+	return redactURL(s)
+}
+
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,130 @@
+package factory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"cache.ttl", "NFPCF_CACHE_TTL"},
+		{"nrf.healthCheck.interval", "NFPCF_NRF_HEALTH_CHECK_INTERVAL"},
+		{"nrf.oauth2.nfInstanceId", "NFPCF_NRF_OAUTH2_NF_INSTANCE_ID"},
+		{"server.tls.clientCa", "NFPCF_SERVER_TLS_CLIENT_CA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := envName(tt.path); got != tt.want {
+				t.Errorf("envName() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	overrides, unknown := EnvOverrides([]string{
+		"NFPCF_CACHE_TTL=1m",
+		"NFPCF_CONFIG=/etc/nfpcf.yaml",
+		"NFPCF_CACHE_TTLL=1m",
+		"NRF_URL=http://legacy:8000",
+		"PATH=/usr/bin",
+	}, "NFPCF_CONFIG")
+
+	wantOverrides := []Override{
+		{Path: "nrf.url", Value: "http://legacy:8000", Source: "NRF_URL"},
+		{Path: "cache.ttl", Value: "1m", Source: "NFPCF_CACHE_TTL"},
+	}
+	if !reflect.DeepEqual(overrides, wantOverrides) {
+		t.Errorf("overrides = %+v, want %+v", overrides, wantOverrides)
+	}
+	if !reflect.DeepEqual(unknown, []string{"NFPCF_CACHE_TTLL"}) {
+		t.Errorf("unknown = %q, want [NFPCF_CACHE_TTLL]", unknown)
+	}
+}
+
+func TestOverridePrecedence(t *testing.T) {
+	file := baseConfig + `
+cache:
+  ttl: 1m
+`
+	flag := Override{Path: "nrf.url", Value: "http://flag:8000", Source: "--nrf.url"}
+
+	tests := []struct {
+		name    string
+		environ []string
+		flags   []Override
+		want    string
+	}{
+		{name: "file", want: "http://nrf:8000"},
+		{name: "legacy variable over file", environ: []string{"NRF_URL=http://legacy:8000"}, want: "http://legacy:8000"},
+		{name: "variable over legacy variable", environ: []string{
+			"NFPCF_NRF_URL=http://env:8000",
+			"NRF_URL=http://legacy:8000",
+		}, want: "http://env:8000"},
+		{name: "flag over variables", environ: []string{
+			"NFPCF_NRF_URL=http://env:8000",
+			"NRF_URL=http://legacy:8000",
+		}, flags: []Override{flag}, want: "http://flag:8000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Environment variables, then flags, as the command line does
+			overrides, _ := EnvOverrides(tt.environ)
+			overrides = append(overrides, tt.flags...)
+
+			config, err := ReadConfig(writeConfig(t, file), overrides...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.NRF.URL != tt.want {
+				t.Errorf("nrf.url = %s, want %s", config.NRF.URL, tt.want)
+			}
+			if config.Cache.TTL != time.Minute {
+				t.Errorf("cache.ttl = %s, want 1m", config.Cache.TTL)
+			}
+		})
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		value   string
+		check   func(*Config) bool
+		wantErr bool
+	}{
+		{name: "duration", path: "cache.ttl", value: "90s", check: func(c *Config) bool {
+			return c.Cache.TTL == 90*time.Second
+		}},
+		{name: "string list", path: "nrf.endpoints", value: "http://a:8000, http://b:8000", check: func(c *Config) bool {
+			return reflect.DeepEqual(c.NRF.Endpoints, []string{"http://a:8000", "http://b:8000"})
+		}},
+		{name: "map", path: "ordering.nfTypePolicies", value: "{SMF: weighted}", check: func(c *Config) bool {
+			return c.Ordering.NfTypePolicies["SMF"] == "weighted"
+		}},
+		{name: "new section", path: "server.tls.cert", value: "nfpcf.pem", check: func(c *Config) bool {
+			return c.Server.TLS.Cert == "nfpcf.pem"
+		}},
+		{name: "bad duration", path: "cache.ttl", value: "90", wantErr: true},
+		{name: "bad boolean", path: "admin.enable", value: "maybe", wantErr: true},
+		{name: "unknown setting", path: "cache.size", value: "10", wantErr: true},
+		{name: "not a section", path: "cache.ttl.unit", value: "s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Cache: &Cache{}, NRF: &NRF{}, Ordering: &Ordering{}, Server: &Server{}}
+			err := setPath(reflect.ValueOf(config).Elem(), tt.path, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("setPath() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !tt.check(config) {
+				t.Errorf("setPath() did not set %s to %s", tt.path, tt.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package factory
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/free5gc/nfpcf/internal/logger"
+	"github.com/free5gc/nfpcf/internal/ordering"
+	"github.com/free5gc/nfpcf/internal/tlsutil"
+)
+
+// ValidationError lists every problem found in a configuration, each
+// prefixed with the YAML path of the setting, e.g. "cache.ttl: ...".
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(path string, format string, args ...interface{}) {
+	v.problems = append(v.problems, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// Validate checks the configuration as completed by ReadConfig and reports
+// all problems at once as a *ValidationError.
+func (c *Config) Validate() error {
+	v := &validator{}
+	c.validate(v)
+	return v.err()
+}
+
+func (c *Config) validate(v *validator) {
+	config := reflect.ValueOf(c).Elem()
+	for i := 0; i < config.NumField(); i++ {
+		if config.Field(i).IsNil() {
+			name, _, _ := strings.Cut(config.Type().Field(i).Tag.Get("yaml"), ",")
+			v.addf(name, "section is missing")
+		}
+	}
+	negativeDurations(v, "", config)
+
+	if c.Server != nil {
+		v.bindAddr("server.bindAddr", c.Server.BindAddr)
+		if c.Server.TLS != nil {
+			if c.Server.TLS.BindAddr != "" {
+				v.bindAddr("server.tls.bindAddr", c.Server.TLS.BindAddr)
+			}
+			v.serverTLS("server.tls", c.Server.TLS)
+		}
+		if c.Server.OAuth2 != nil && c.Server.OAuth2.Enable && len(c.Server.OAuth2.Keys) == 0 {
+			v.addf("server.oauth2.keys", "at least one key file is required")
+		}
+	}
+
+	if c.NRF != nil {
+		c.NRF.validate(v)
+	}
+
+	if c.Cache != nil {
+		if c.Cache.TTL == 0 {
+			v.addf("cache.ttl", "must be positive, got %s", c.Cache.TTL)
+		}
+		for i, policy := range c.Cache.TTLPolicies {
+			path := fmt.Sprintf("cache.ttlPolicies[%d]", i)
+			if policy.TTL <= 0 {
+				v.addf(path+".ttl", "must be positive, got %s", policy.TTL)
+			}
+			if policy.NfType == "" && len(policy.Query) == 0 {
+				v.addf(path, "nfType or query is required")
+			}
+		}
+	}
+
+	if c.Logger != nil {
+		if err := logger.ValidateLevel(c.Logger.Level); err != nil {
+			v.addf("logger.level", "%v", err)
+		}
+		if err := logger.ValidateFormat(c.Logger.Format); err != nil {
+			v.addf("logger.format", "%v", err)
+		}
+	}
+
+	if c.Ordering != nil {
+		if _, err := ordering.ParsePolicy(c.Ordering.DefaultPolicy); err != nil {
+			v.addf("ordering.defaultPolicy", "%v", err)
+		}
+		for nfType, policy := range c.Ordering.NfTypePolicies {
+			if _, err := ordering.ParsePolicy(policy); err != nil {
+				v.addf("ordering.nfTypePolicies."+nfType, "%v", err)
+			}
+		}
+	}
+
+	if c.Subscriptions != nil {
+		if c.Subscriptions.FanOut {
+			v.url("subscriptions.callbackUri", c.Subscriptions.CallbackURI)
+		}
+		if c.Subscriptions.NotifyTimeout == 0 {
+			v.addf("subscriptions.notifyTimeout", "must be positive")
+		}
+	}
+
+	if c.Metrics != nil && c.Metrics.Enable {
+		v.bindAddr("metrics.bindAddr", c.Metrics.BindAddr)
+	}
+
+	if c.Tracing != nil && c.Tracing.Enable {
+		switch c.Tracing.Exporter {
+		case "otlp":
+			v.url("tracing.endpoint", c.Tracing.Endpoint)
+		case "stdout":
+		case "file":
+			if c.Tracing.File == "" {
+				v.addf("tracing.file", "required with the file exporter")
+			}
+		default:
+			v.addf("tracing.exporter", "unknown exporter %q (want otlp, stdout or file)", c.Tracing.Exporter)
+		}
+		if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+			v.addf("tracing.sampleRatio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+		}
+	}
+
+	if c.Admin != nil && c.Admin.Enable {
+		v.bindAddr("admin.bindAddr", c.Admin.BindAddr)
+		if c.Admin.TLS != nil {
+			v.serverTLS("admin.tls", c.Admin.TLS)
+		}
+		if c.Admin.Token == "" && (c.Admin.TLS == nil || c.Admin.TLS.ClientAuth != "require-and-verify") {
+			v.addf("admin.token", "required unless admin.tls.clientAuth is require-and-verify")
+		}
+		if c.Admin.Token != "" && c.Admin.TLS == nil && !c.Admin.Loopback() {
+			v.addf("admin.tls", "required to send admin.token to the non-loopback address %q", c.Admin.BindAddr)
+		}
+	}
+
+	if c.Shutdown != nil && c.Shutdown.DrainTimeout == 0 {
+		v.addf("shutdown.drainTimeout", "must be positive")
+	}
+
+	if c.Reload != nil && c.Reload.Interval == 0 {
+		v.addf("reload.interval", "must be positive")
+	}
+}
+
+func (n *NRF) validate(v *validator) {
+	if n.URL == "" && len(n.Endpoints) == 0 {
+		v.addf("nrf.url", "required unless nrf.endpoints is set")
+	}
+	if n.URL != "" {
+		v.url("nrf.url", n.URL)
+	}
+	for i, endpoint := range n.Endpoints {
+		v.url(fmt.Sprintf("nrf.endpoints[%d]", i), endpoint)
+	}
+	if n.RoamingURL != "" {
+		v.url("nrf.roamingUrl", n.RoamingURL)
+	}
+	for i, plmn := range n.HomePlmnList {
+		v.plmn(fmt.Sprintf("nrf.homePlmnList[%d]", i), plmn)
+	}
+	for i, route := range n.PlmnRoutes {
+		v.plmn(fmt.Sprintf("nrf.plmnRoutes[%d].plmn", i), route.Plmn)
+		v.url(fmt.Sprintf("nrf.plmnRoutes[%d].url", i), route.URL)
+		v.clientTLS(fmt.Sprintf("nrf.plmnRoutes[%d].tls", i), route.TLS)
+	}
+
+	switch n.LoadBalancing {
+	case "primary-secondary", "round-robin":
+	default:
+		v.addf("nrf.loadBalancing", "unknown policy %q (want primary-secondary or round-robin)", n.LoadBalancing)
+	}
+
+	if hc := n.HealthCheck; hc != nil {
+		if hc.Enable && hc.Interval > 0 && hc.Timeout == 0 {
+			v.addf("nrf.healthCheck.timeout", "must be positive")
+		}
+		if !strings.HasPrefix(hc.Path, "/") {
+			v.addf("nrf.healthCheck.path", "must start with /, got %q", hc.Path)
+		}
+	}
+
+	if n.Timeouts != nil && n.Timeouts.Default == 0 {
+		v.addf("nrf.timeouts.default", "must be positive")
+	}
+
+	if retry := n.Retry; retry != nil {
+		if retry.MaxAttempts < 1 {
+			v.addf("nrf.retry.maxAttempts", "must be at least 1, got %d", retry.MaxAttempts)
+		}
+		if retry.Multiplier < 1 {
+			v.addf("nrf.retry.multiplier", "must be at least 1, got %g", retry.Multiplier)
+		}
+		if retry.InitialBackoff > retry.MaxBackoff {
+			v.addf("nrf.retry.initialBackoff", "must not exceed nrf.retry.maxBackoff (%s)", retry.MaxBackoff)
+		}
+	}
+
+	if cb := n.CircuitBreaker; cb != nil && cb.Enable {
+		if cb.ConsecutiveFailures < 1 {
+			v.addf("nrf.circuitBreaker.consecutiveFailures", "must be at least 1")
+		}
+		if cb.ErrorRateThreshold <= 0 || cb.ErrorRateThreshold > 1 {
+			v.addf("nrf.circuitBreaker.errorRateThreshold", "must be above 0 and at most 1, got %g", cb.ErrorRateThreshold)
+		}
+		if cb.MinRequests < 1 {
+			v.addf("nrf.circuitBreaker.minRequests", "must be at least 1")
+		}
+		if cb.HalfOpenMaxRequests < 1 {
+			v.addf("nrf.circuitBreaker.halfOpenMaxRequests", "must be at least 1")
+		}
+		if cb.Window == 0 {
+			v.addf("nrf.circuitBreaker.window", "must be positive")
+		}
+		if cb.OpenTimeout == 0 {
+			v.addf("nrf.circuitBreaker.openTimeout", "must be positive")
+		}
+	}
+
+	v.clientTLS("nrf.tls", n.TLS)
+	v.clientTLS("nrf.roamingTls", n.RoamingTLS)
+
+	if n.OAuth2 != nil && n.OAuth2.Enable {
+		if n.OAuth2.NfInstanceID == "" {
+			v.addf("nrf.oauth2.nfInstanceId", "required when nrf.oauth2 is enabled")
+		}
+		if n.OAuth2.NfType == "" {
+			v.addf("nrf.oauth2.nfType", "required when nrf.oauth2 is enabled")
+		}
+	}
+}
+
+func (v *validator) clientTLS(path string, config *ClientTLS) {
+	if config == nil {
+		return
+	}
+	if _, err := tlsutil.ParseVersion(config.MinVersion); err != nil {
+		v.addf(path+".minVersion", "%v", err)
+	}
+	if (config.Cert == "") != (config.Key == "") {
+		v.addf(path, "cert and key must be set together")
+	}
+}
+
+func (v *validator) serverTLS(path string, config *ServerTLS) {
+	if config.Cert == "" {
+		v.addf(path+".cert", "required")
+	}
+	if config.Key == "" {
+		v.addf(path+".key", "required")
+	}
+	if _, err := tlsutil.ParseVersion(config.MinVersion); err != nil {
+		v.addf(path+".minVersion", "%v", err)
+	}
+	if _, err := tlsutil.ParseClientAuth(config.ClientAuth); err != nil {
+		v.addf(path+".clientAuth", "%v", err)
+	}
+	if config.ReloadInterval == 0 {
+		v.addf(path+".reloadInterval", "must be positive")
+	}
+}
+
+// url checks an absolute http or https URL with a host.
+func (v *validator) url(path string, raw string) {
+	u, err := url.Parse(raw)
+	switch {
+	case raw == "":
+		v.addf(path, "required")
+	case err != nil:
+		v.addf(path, "invalid URL %q", redactURL(raw))
+	case u.Scheme != "http" && u.Scheme != "https":
+		v.addf(path, "URL %q must use http or https", redactURL(raw))
+	case u.Host == "":
+		v.addf(path, "URL %q has no host", redactURL(raw))
+	}
+}
+
+// bindAddr checks a listen address of the form [host]:port.
+func (v *validator) bindAddr(path string, addr string) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		v.addf(path, "invalid address %q, want host:port", addr)
+		return
+	}
+	if n, err := strconv.ParseUint(port, 10, 16); err != nil || (n == 0 && port != "0") {
+		v.addf(path, "invalid port %q", port)
+	}
+}
+
+func (v *validator) plmn(path string, plmn PlmnID) {
+	if !isDigits(plmn.Mcc, 3, 3) {
+		v.addf(path+".mcc", "must be 3 digits, got %q", plmn.Mcc)
+	}
+	if !isDigits(plmn.Mnc, 2, 3) {
+		v.addf(path+".mnc", "must be 2 or 3 digits, got %q", plmn.Mnc)
+	}
+}
+
+func isDigits(s string, minLen, maxLen int) bool {
+	if len(s) < minLen || len(s) > maxLen {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// negativeDurations reports every negative duration below v.
+func negativeDurations(vd *validator, prefix string, v reflect.Value) {
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct:
+			if !field.IsNil() {
+				negativeDurations(vd, path, field.Elem())
+			}
+		case field.Type() == durationType && field.Int() < 0:
+			vd.addf(path, "must not be negative, got %s", time.Duration(field.Int()))
+		}
+	}
+}
+
+// bareDurations reports durations written as plain numbers in the YAML
+// document raw, which would be read as nanoseconds.
+func bareDurations(v *validator, prefix string, t reflect.Type, raw interface{}) {
+	section, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+
+		value, set := section[name]
+		if !set {
+			continue
+		}
+		fieldType := t.Field(i).Type
+		switch {
+		case fieldType == durationType:
+			var n int64
+			switch number := value.(type) {
+			case int:
+				n = int64(number)
+			case int64:
+				n = number
+			case uint64:
+				n = int64(number)
+			case float64:
+				n = int64(number)
+			default:
+				continue
+			}
+			if n == 0 {
+				continue
+			}
+			// Large values are likely nanoseconds written on purpose
+			suggestion := fmt.Sprintf("%vs", value)
+			if time.Duration(n) >= time.Millisecond {
+				suggestion = time.Duration(n).String()
+			}
+			v.addf(path, "%v has no unit and would be read as %s; write a duration such as %q",
+				value, time.Duration(n), suggestion)
+		case fieldType.Kind() == reflect.Ptr && fieldType.Elem().Kind() == reflect.Struct:
+			bareDurations(v, path, fieldType.Elem(), value)
+		case fieldType.Kind() == reflect.Slice && fieldType.Elem().Kind() == reflect.Struct:
+			items, _ := value.([]interface{})
+			for j, item := range items {
+				bareDurations(v, fmt.Sprintf("%s[%d]", path, j), fieldType.Elem(), item)
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package factory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   []string
+	}{
+		{name: "defaults", modify: func(c *Config) {}},
+		{name: "missing section", modify: func(c *Config) { c.Cache = nil }, want: []string{"cache"}},
+		{name: "zero cache ttl", modify: func(c *Config) { c.Cache.TTL = 0 }, want: []string{"cache.ttl"}},
+		{name: "negative duration", modify: func(c *Config) { c.Cache.StaleTTL = -time.Second }, want: []string{"cache.staleTtl"}},
+		{name: "ttl policy", modify: func(c *Config) {
+			c.Cache.TTLPolicies = []TTLPolicy{{TTL: time.Minute}, {NfType: "SMF"}}
+		}, want: []string{"cache.ttlPolicies[0]", "cache.ttlPolicies[1].ttl"}},
+		{name: "nrf url", modify: func(c *Config) { c.NRF.URL = "nrf:8000" }, want: []string{"nrf.url"}},
+		{name: "nrf endpoints instead of url", modify: func(c *Config) {
+			c.NRF.URL = ""
+			c.NRF.Endpoints = []string{"http://nrf-0:8000", "http://nrf-1:8000"}
+		}},
+		{name: "plmn", modify: func(c *Config) {
+			c.NRF.HomePlmnList = []PlmnID{{Mcc: "20", Mnc: "9x"}}
+		}, want: []string{"nrf.homePlmnList[0].mcc", "nrf.homePlmnList[0].mnc"}},
+		{name: "retry", modify: func(c *Config) {
+			c.NRF.Retry.MaxAttempts = 0
+			c.NRF.Retry.InitialBackoff = time.Minute
+		}, want: []string{"nrf.retry.maxAttempts", "nrf.retry.initialBackoff"}},
+		{name: "disabled circuit breaker is not checked", modify: func(c *Config) {
+			c.NRF.CircuitBreaker = &CircuitBreaker{}
+		}},
+		{name: "oauth2 without identity", modify: func(c *Config) {
+			c.NRF.OAuth2 = &OAuth2{Enable: true}
+		}, want: []string{"nrf.oauth2.nfInstanceId", "nrf.oauth2.nfType"}},
+		{name: "client tls", modify: func(c *Config) {
+			c.NRF.TLS = &ClientTLS{Cert: "nfpcf.pem", MinVersion: "1.0"}
+		}, want: []string{"nrf.tls", "nrf.tls.minVersion"}},
+		{name: "server tls", modify: func(c *Config) {
+			c.Server.TLS = &ServerTLS{ClientAuth: "always", ReloadInterval: time.Second}
+		}, want: []string{"server.tls.cert", "server.tls.key", "server.tls.clientAuth"}},
+		{name: "bind address", modify: func(c *Config) { c.Server.BindAddr = "8000" }, want: []string{"server.bindAddr"}},
+		{name: "admin without token", modify: func(c *Config) { c.Admin.Enable = true }, want: []string{"admin.token"}},
+		{name: "admin token on loopback", modify: func(c *Config) {
+			c.Admin.Enable = true
+			c.Admin.Token = "secret"
+		}},
+		{name: "admin token in clear text", modify: func(c *Config) {
+			c.Admin.Enable = true
+			c.Admin.Token = "secret"
+			c.Admin.BindAddr = ":9091"
+		}, want: []string{"admin.tls"}},
+		{name: "fan-out without callback", modify: func(c *Config) { c.Subscriptions.FanOut = true }, want: []string{"subscriptions.callbackUri"}},
+		{name: "several problems", modify: func(c *Config) {
+			c.Logger.Level = "loud"
+			c.Ordering.DefaultPolicy = "random"
+			c.Reload.Interval = 0
+		}, want: []string{"logger.level", "ordering.defaultPolicy", "reload.interval"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ReadConfig(writeConfig(t, baseConfig))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(config)
+
+			got := problems(t, config.Validate())
+			if len(got) != len(tt.want) {
+				t.Errorf("Validate() problems = %q, want %d", got, len(tt.want))
+			}
+			for _, path := range tt.want {
+				if !hasProblem(got, path) {
+					t.Errorf("no %s problem in %q", path, got)
+				}
+			}
+		})
+	}
+}